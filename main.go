@@ -1,12 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
 	"math"
+	mathrand "math/rand/v2"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
 )
 
 // FinancialData represents monthly financial data
@@ -15,6 +42,75 @@ type FinancialData struct {
 	Income  float64 `json:"income"`
 	Expense float64 `json:"expense"`
 	NetFlow float64 `json:"net_flow"`
+	// Currency is the ISO 4217 code of a historical month's amounts; when set
+	// it must agree with the company's currency and the other months
+	Currency string `json:"currency,omitempty"`
+	// EventAdjusted marks predicted months changed by a ForecastEvent
+	EventAdjusted bool `json:"event_adjusted,omitempty"`
+	// ExpenseCapped marks predicted months whose expense was held to the
+	// request's expense_cap_ratio
+	ExpenseCapped bool `json:"expense_capped,omitempty"`
+	// ZeroFloored marks predicted months whose income or expense came out
+	// negative and was raised to zero
+	ZeroFloored bool `json:"zero_floored,omitempty"`
+	// ExpenseFloored marks predicted months whose expense was raised toward
+	// the floor derived from the company's average expense
+	ExpenseFloored bool `json:"expense_floored,omitempty"`
+	// Confidence is a 0-1 trust score for predicted months
+	Confidence float64 `json:"confidence,omitempty"`
+	// DaysElapsed and DaysInMonth mark the latest historical month as still
+	// in progress; the trend uses it prorated to a full month
+	DaysElapsed int `json:"days_elapsed,omitempty"`
+	DaysInMonth int `json:"days_in_month,omitempty"`
+	// Deltas is set on predicted months when the request asks for deltas
+	Deltas *ForecastDeltas `json:"deltas,omitempty"`
+	// Interval is the 80% forecast range of a predicted month
+	Interval *ForecastInterval `json:"interval,omitempty"`
+	// Fan holds the nested bands of a fan chart, narrowest level first
+	Fan []FanBand `json:"fan,omitempty"`
+}
+
+// ForecastDeltas expresses a predicted month as changes: the *Delta fields
+// are cumulative from the last historical month, the *Change fields are
+// period-over-period from the month before
+type ForecastDeltas struct {
+	IncomeDelta   float64 `json:"income_delta"`
+	ExpenseDelta  float64 `json:"expense_delta"`
+	NetFlowDelta  float64 `json:"net_flow_delta"`
+	IncomeChange  float64 `json:"income_change"`
+	ExpenseChange float64 `json:"expense_change"`
+	NetFlowChange float64 `json:"net_flow_change"`
+}
+
+// ProratedMonth reports the full-month estimate used for an in-progress month
+type ProratedMonth struct {
+	Month            string  `json:"month"`
+	DaysElapsed      int     `json:"days_elapsed"`
+	DaysInMonth      int     `json:"days_in_month"`
+	EstimatedIncome  float64 `json:"estimated_income"`
+	EstimatedExpense float64 `json:"estimated_expense"`
+}
+
+// ForecastEvent is a known future income/expense change applied on top of the model output
+type ForecastEvent struct {
+	Month        string  `json:"month"`
+	IncomeDelta  float64 `json:"income_delta"`
+	ExpenseDelta float64 `json:"expense_delta"`
+}
+
+// CapitalInjection is a one-time cash inflow, e.g. a funding round, added to
+// the balance of a forecast month. It is financing, not income: the
+// predictions and the trend behind them are left as they are.
+type CapitalInjection struct {
+	Month  string  `json:"month"`
+	Amount float64 `json:"amount"`
+}
+
+// BudgetTarget is the company's planned income and expense for one month
+type BudgetTarget struct {
+	Month   string  `json:"month"`
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
 }
 
 // CompanyProfile represents the company's basic info
@@ -24,403 +120,7553 @@ type CompanyProfile struct {
 	Sector            string  `json:"sector"`
 	MonthlyAvgIncome  float64 `json:"monthly_avg_income"`
 	MonthlyAvgExpense float64 `json:"monthly_avg_expense"`
+	// FiscalYearStartMonth is the calendar month (1-12) the fiscal year and
+	// the submitted history start in; 0 means January
+	FiscalYearStartMonth int `json:"fiscal_year_start_month,omitempty"`
+	// EmployeeCount enables the per-employee figures in the summary
+	EmployeeCount int `json:"employee_count,omitempty"`
+	// Currency is the ISO 4217 code the amounts are reported in, e.g. TRY
+	Currency string `json:"currency,omitempty"`
 }
 
 // FinancialAnalysis represents the complete financial analysis
 type FinancialAnalysis struct {
-	Company        CompanyProfile  `json:"company"`
-	HistoricalData []FinancialData `json:"historical_data"`
-	Predictions    []FinancialData `json:"predictions"`
-	Summary        AnalysisSummary `json:"summary"`
-	CreatedAt      time.Time       `json:"created_at"`
+	ID             string            `json:"id"`
+	Company        CompanyProfile    `json:"company"`
+	HistoricalData []FinancialData   `json:"historical_data"`
+	HistoryWindow  int               `json:"history_window"`
+	Predictions    []FinancialData   `json:"predictions"`
+	Summary        AnalysisSummary   `json:"summary"`
+	Seasonality    SeasonalityInfo   `json:"seasonality"`
+	Sensitivity    SensitivityReport `json:"sensitivity"`
+	// ExpenseStep is set when expenses jumped to a new plateau, e.g. a new lease
+	ExpenseStep *ExpenseStep `json:"expense_step,omitempty"`
+	// ExpenseCap is set when the request holds expenses to a share of income
+	ExpenseCap *ExpenseCapReport `json:"expense_cap,omitempty"`
+	// ExpenseFloor is set when predicted expenses were held up to the
+	// company's established expense level
+	ExpenseFloor *ExpenseFloorReport `json:"expense_floor,omitempty"`
+	// IncomeCeiling is set when the request caps income at a capacity ceiling
+	IncomeCeiling *CeilingReport `json:"income_ceiling,omitempty"`
+	// SeasonallyAdjustedHistory is set when the request includes it
+	SeasonallyAdjustedHistory []AdjustedMonth `json:"seasonally_adjusted_history,omitempty"`
+	// BreakEven is set when the request asks for simulations
+	BreakEven *BreakEven `json:"break_even,omitempty"`
+	// ZeroFloorMonths lists the predicted months raised to the zero floor
+	ZeroFloorMonths []string `json:"zero_floor_months,omitempty"`
+	// ProratedMonth is set when the latest historical month was in progress
+	ProratedMonth *ProratedMonth `json:"prorated_month,omitempty"`
+	// BiasCorrection is the company's learned correction applied to the forecast
+	BiasCorrection *BiasCorrection `json:"bias_correction,omitempty"`
+	// BalanceProjection is set when the request carries an opening balance
+	// or a capital injection
+	BalanceProjection *BalanceProjection `json:"balance_projection,omitempty"`
+	// CapitalInjection compares the balance outlook with and without the
+	// request's capital injection
+	CapitalInjection *InjectionImpact `json:"capital_injection,omitempty"`
+	// BudgetComparison is set when the request carries a budget
+	BudgetComparison *BudgetComparison `json:"budget_comparison,omitempty"`
+	// Decomposition holds the trend/seasonal/residual components of the decompose model
+	Decomposition *DecompositionResult `json:"decomposition,omitempty"`
+	Warnings      []AnalysisWarning    `json:"warnings,omitempty"`
+	// RerunOf is the ID of the stored analysis this one replays
+	RerunOf string `json:"rerun_of,omitempty"`
+
+	// modelOutput is the forecast as the model produced it, before the bias
+	// correction, events and the other adjustments
+	modelOutput []FinancialData
+	// Explain is the trace of intermediate values requested with ?explain=true
+	Explain   *ForecastTrace `json:"explain,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AnalysisWarning flags a data issue found while analyzing
+type AnalysisWarning struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Months  []string `json:"months,omitempty"`
+}
+
+// BalancePoint is the cash balance at the end of one month
+type BalancePoint struct {
+	Month string `json:"month"`
+	// Type is historical or predicted
+	Type              string  `json:"type"`
+	NetFlow           float64 `json:"net_flow"`
+	CumulativeNetFlow float64 `json:"cumulative_net_flow"`
+	// Injection is the capital injected this month, part of Balance but not
+	// of the net flow
+	Injection float64 `json:"injection,omitempty"`
+	Balance   float64 `json:"balance"`
+}
+
+// BalanceProjection is the bank balance curve over the history and forecast
+type BalanceProjection struct {
+	OpeningBalance  float64        `json:"opening_balance"`
+	Months          []BalancePoint `json:"months"`
+	MinBalance      float64        `json:"min_balance"`
+	MinBalanceMonth string         `json:"min_balance_month"`
+	GoesNegative    bool           `json:"goes_negative"`
+}
+
+// BudgetVariance compares one forecast month with its budget target.
+// Variances are forecast minus budget.
+type BudgetVariance struct {
+	Month           string  `json:"month"`
+	BudgetIncome    float64 `json:"budget_income"`
+	ForecastIncome  float64 `json:"forecast_income"`
+	IncomeVariance  float64 `json:"income_variance"`
+	BudgetExpense   float64 `json:"budget_expense"`
+	ForecastExpense float64 `json:"forecast_expense"`
+	ExpenseVariance float64 `json:"expense_variance"`
+	NetFlowVariance float64 `json:"net_flow_variance"`
+	OnTrack         bool    `json:"on_track"`
+}
+
+// BudgetComparison aggregates the per-month budget variances
+type BudgetComparison struct {
+	Months               []BudgetVariance `json:"months"`
+	TotalIncomeVariance  float64          `json:"total_income_variance"`
+	TotalExpenseVariance float64          `json:"total_expense_variance"`
+	TotalNetFlowVariance float64          `json:"total_net_flow_variance"`
+	// MissedMonths lists the months whose forecast net flow falls short of the budget
+	MissedMonths []string `json:"missed_months,omitempty"`
+	// Verdict is Hedefte, Sınırda or Hedefin Gerisinde
+	Verdict string `json:"verdict"`
+}
+
+// SeriesDecomposition splits one historical series into its components and
+// carries the extrapolated trend for the forecast months
+type SeriesDecomposition struct {
+	Trend         []float64 `json:"trend"`
+	Seasonal      []float64 `json:"seasonal"`
+	Residual      []float64 `json:"residual"`
+	TrendForecast []float64 `json:"trend_forecast"`
+}
+
+// DecompositionResult holds the income and expense decompositions
+type DecompositionResult struct {
+	Mode    string              `json:"mode"`
+	Income  SeriesDecomposition `json:"income"`
+	Expense SeriesDecomposition `json:"expense"`
+}
+
+// SensitivityScenario is the forecast outcome for one growth-rate perturbation
+type SensitivityScenario struct {
+	GrowthDelta           float64 `json:"growth_delta"`
+	IncomeGrowthRate      float64 `json:"income_growth_rate"`
+	PredictedTotalNetFlow float64 `json:"predicted_total_net_flow"`
+}
+
+// SensitivityReport shows how much the forecast moves when the income growth rate is off
+type SensitivityReport struct {
+	BaseIncomeGrowthRate  float64               `json:"base_income_growth_rate"`
+	Scenarios             []SensitivityScenario `json:"scenarios"`
+	MinPredictedNetFlow   float64               `json:"min_predicted_net_flow"`
+	MaxPredictedNetFlow   float64               `json:"max_predicted_net_flow"`
+	PredictedNetFlowRange float64               `json:"predicted_net_flow_range"`
 }
 
 // AnalysisSummary provides key insights
 type AnalysisSummary struct {
-	TotalHistoricalIncome  float64  `json:"total_historical_income"`
-	TotalHistoricalExpense float64  `json:"total_historical_expense"`
-	TotalHistoricalNetFlow float64  `json:"total_historical_net_flow"`
-	PredictedTotalIncome   float64  `json:"predicted_total_income"`
-	PredictedTotalExpense  float64  `json:"predicted_total_expense"`
-	PredictedTotalNetFlow  float64  `json:"predicted_total_net_flow"`
-	GrowthTrend            string   `json:"growth_trend"`
-	RiskLevel              string   `json:"risk_level"`
-	CashFlowHealth         string   `json:"cash_flow_health"`
-	Recommendations        []string `json:"recommendations"`
+	TotalHistoricalIncome  float64              `json:"total_historical_income"`
+	TotalHistoricalExpense float64              `json:"total_historical_expense"`
+	TotalHistoricalNetFlow float64              `json:"total_historical_net_flow"`
+	PositiveNetFlowMonths  int                  `json:"positive_net_flow_months"`
+	NegativeNetFlowMonths  int                  `json:"negative_net_flow_months"`
+	LongestNegativeStreak  int                  `json:"longest_negative_streak"`
+	PredictedTotalIncome   float64              `json:"predicted_total_income"`
+	PredictedTotalExpense  float64              `json:"predicted_total_expense"`
+	PredictedTotalNetFlow  float64              `json:"predicted_total_net_flow"`
+	IncomeGrowthRate       float64              `json:"income_growth_rate"`
+	ExpenseGrowthRate      float64              `json:"expense_growth_rate"`
+	IncomeGrowthSource     string               `json:"income_growth_source"`
+	ExpenseGrowthSource    string               `json:"expense_growth_source"`
+	RatePeriod             string               `json:"rate_period"`
+	NetFlowMode            string               `json:"net_flow_mode"`
+	ReliableHorizonMonths  int                  `json:"reliable_horizon_months"`
+	GrowthTrend            string               `json:"growth_trend"`
+	GrowthTrendCode        string               `json:"growth_trend_code"`
+	RiskLevel              string               `json:"risk_level"`
+	RiskLevelCode          string               `json:"risk_level_code"`
+	RiskScore              float64              `json:"risk_score"`
+	CashFlowHealth         string               `json:"cash_flow_health"`
+	CashFlowHealthCode     string               `json:"cash_flow_health_code"`
+	Recommendations        []string             `json:"recommendations"`
+	RecommendationDetails  []Recommendation     `json:"recommendation_details"`
+	ExpenseRatioAlerts     []ExpenseRatioAlert  `json:"expense_ratio_alerts,omitempty"`
+	PeakExpenseGrowth      *MonthlyGrowth       `json:"peak_expense_growth,omitempty"`
+	Momentum               *ProfitMomentum      `json:"momentum,omitempty"`
+	LifecyclePhase         *LifecyclePhase      `json:"lifecycle_phase,omitempty"`
+	HalfComparison         *HalfComparison      `json:"half_comparison,omitempty"`
+	SustainableGrowth      *SustainableGrowth   `json:"sustainable_growth,omitempty"`
+	SeasonalPhase          *SeasonalPhase       `json:"seasonal_phase,omitempty"`
+	NetFlowDistribution    *NetFlowHistogram    `json:"net_flow_distribution,omitempty"`
+	PerEmployee            *PerEmployeeMetrics  `json:"per_employee,omitempty"`
+	ExpenseCoverageMonths  ExpenseCoverage      `json:"expense_coverage_months"`
+	VsBenchmark            *BenchmarkComparison `json:"vs_benchmark,omitempty"`
+	Narrative              string               `json:"narrative"`
+}
+
+// ProfitMomentum tells whether net flow growth is speeding up or slowing
+// down, from the second difference of the historical net flow
+type ProfitMomentum struct {
+	State     string `json:"state"`
+	StateCode string `json:"state_code"`
+	// Acceleration is the month-over-month change in net flow growth, the
+	// curvature of a parabola fitted to the whole net flow history
+	Acceleration float64 `json:"acceleration"`
+	// InflectionMonth is the latest month where the acceleration changed sign
+	InflectionMonth string `json:"inflection_month,omitempty"`
+}
+
+// LifecyclePhase classifies the company from the level and acceleration of
+// its net flow. Slope is the least-squares monthly change in net flow.
+type LifecyclePhase struct {
+	Phase     string  `json:"phase"`
+	PhaseCode string  `json:"phase_code"`
+	Slope     float64 `json:"slope"`
+}
+
+// HalfComparison sets the total net flow of the first half of the history
+// against the second half; with an odd month count the middle month is left
+// out so both halves are equally long
+type HalfComparison struct {
+	HalfMonths        int     `json:"half_months"`
+	FirstHalfNetFlow  float64 `json:"first_half_net_flow"`
+	SecondHalfNetFlow float64 `json:"second_half_net_flow"`
+	Change            float64 `json:"change"`
+	// ChangePct is relative to the size of the first half, so it is
+	// positive whenever the second half did better; nil when the first half
+	// netted zero
+	ChangePct *float64 `json:"change_pct"`
+}
+
+// SeasonalPhase compares the seasonal profiles of income and expense.
+// PhaseOffsetMonths is how many months the expense cycle is shifted from the
+// income cycle (negative when expenses peak earlier). TimingRisk flags a
+// significant shift, with RiskMonths holding the months where expenses run
+// above their average while income runs below its own.
+type SeasonalPhase struct {
+	IncomePeakMonth   string   `json:"income_peak_month"`
+	ExpensePeakMonth  string   `json:"expense_peak_month"`
+	PhaseOffsetMonths int      `json:"phase_offset_months"`
+	TimingRisk        bool     `json:"timing_risk"`
+	RiskMonths        []string `json:"risk_months,omitempty"`
+}
+
+// MonthlyGrowth is the month-over-month growth into one historical month
+type MonthlyGrowth struct {
+	Month      string  `json:"month"`
+	GrowthRate float64 `json:"growth_rate"`
+}
+
+// ExpenseCoverage is how many months of average expenses the accumulated
+// cash could pay if income stopped, at the end of the history and of the
+// forecast. Basis is opening_balance when the cash includes an opening
+// balance, net_flow when it is the accumulated net flow alone.
+type ExpenseCoverage struct {
+	Historical float64 `json:"historical"`
+	Predicted  float64 `json:"predicted"`
+	Basis      string  `json:"basis"`
+}
+
+// PerEmployeeMetrics divides the historical and predicted totals by the
+// company's employee count
+type PerEmployeeMetrics struct {
+	EmployeeCount     int     `json:"employee_count"`
+	HistoricalIncome  float64 `json:"historical_income"`
+	HistoricalExpense float64 `json:"historical_expense"`
+	HistoricalNetFlow float64 `json:"historical_net_flow"`
+	PredictedIncome   float64 `json:"predicted_income"`
+	PredictedExpense  float64 `json:"predicted_expense"`
+	PredictedNetFlow  float64 `json:"predicted_net_flow"`
+}
+
+// HistogramBucket counts the values in [From, To); the last bucket includes To
+type HistogramBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// NetFlowHistogram describes the spread of the historical monthly net flows
+type NetFlowHistogram struct {
+	Buckets        []HistogramBucket `json:"buckets"`
+	Min            float64           `json:"min"`
+	Max            float64           `json:"max"`
+	Median         float64           `json:"median"`
+	NegativeMonths int               `json:"negative_months"`
+}
+
+// ExpenseRatioAlert flags a predicted month whose expenses come close to or
+// exceed its income. ExpenseRatio is null when the month has no income.
+type ExpenseRatioAlert struct {
+	Month        string   `json:"month"`
+	ExpenseRatio *float64 `json:"expense_ratio"`
+}
+
+// TrendReport is the lightweight growth overview returned by /api/trend
+type TrendReport struct {
+	IncomeGrowthRate  float64 `json:"income_growth_rate"`
+	ExpenseGrowthRate float64 `json:"expense_growth_rate"`
+	RatePeriod        string  `json:"rate_period"`
+	GrowthTrend       string  `json:"growth_trend"`
+	GrowthTrendCode   string  `json:"growth_trend_code"`
+	// NetFlowDirection is Artıyor, Azalıyor or Yatay from the net-flow trend line
+	NetFlowDirection string  `json:"net_flow_direction"`
+	NetFlowSlope     float64 `json:"net_flow_slope"`
+}
+
+// SectorBenchmark holds the typical net margin and monthly income growth range of a sector
+type SectorBenchmark struct {
+	MarginLow  float64 `json:"margin_low"`
+	MarginHigh float64 `json:"margin_high"`
+	GrowthLow  float64 `json:"growth_low"`
+	GrowthHigh float64 `json:"growth_high"`
+}
+
+// BenchmarkComparison places the company's metrics against its sector range
+type BenchmarkComparison struct {
+	Sector         string  `json:"sector"`
+	Margin         float64 `json:"margin"`
+	MarginLow      float64 `json:"margin_low"`
+	MarginHigh     float64 `json:"margin_high"`
+	MarginPosition string  `json:"margin_position"`
+	GrowthRate     float64 `json:"growth_rate"`
+	GrowthLow      float64 `json:"growth_low"`
+	GrowthHigh     float64 `json:"growth_high"`
+	GrowthPosition string  `json:"growth_position"`
 }
 
 // AnalysisRequest represents the input data structure
 type AnalysisRequest struct {
+	// SchemaVersion is the request shape the client was written against;
+	// 0 means the latest supported version
+	SchemaVersion  int             `json:"schema_version,omitempty"`
 	Company        CompanyProfile  `json:"company"`
 	HistoricalData []FinancialData `json:"historical_data"`
+	Annualized     bool            `json:"annualized"`
+	// HistoryWindow limits the forecast to the most recent N months (0 = all)
+	HistoryWindow      int             `json:"history_window"`
+	IncludeFullHistory bool            `json:"include_full_history"`
+	Events             []ForecastEvent `json:"events"`
+	// Model selects the forecast model; empty means compound
+	Model string `json:"model"`
+	// IncomeModel and ExpenseModel select the model of one series, overriding Model
+	IncomeModel  string `json:"income_model,omitempty"`
+	ExpenseModel string `json:"expense_model,omitempty"`
+	// GrowthMethod selects arithmetic or geometric growth-rate aggregation
+	GrowthMethod string `json:"growth_method"`
+	// ZeroIncomePolicy includes (default) or excludes zero-income months from the income trend
+	ZeroIncomePolicy string `json:"zero_income_policy"`
+	// SeasonallyAdjusted marks input that is already deseasonalized
+	SeasonallyAdjusted bool `json:"seasonally_adjusted"`
+	// DecompositionMode is multiplicative (default) or additive for the decompose model
+	DecompositionMode string `json:"decomposition_mode"`
+	// Budget holds monthly targets the forecast is compared against
+	Budget []BudgetTarget `json:"budget"`
+	// OpeningBalance is the cash balance before the first historical month;
+	// when set the response projects the balance month by month
+	OpeningBalance *float64 `json:"opening_balance,omitempty"`
+	// CapitalInjection adds a one-time amount to the balance of a forecast
+	// month; the balance is projected from zero without an opening balance
+	CapitalInjection *CapitalInjection `json:"capital_injection,omitempty"`
+	// TrustNetFlow keeps the supplied net_flow values instead of recomputing
+	// them as income minus expense
+	TrustNetFlow bool `json:"trust_net_flow"`
+	// Tone phrases the recommendations direct (default) or advisory
+	Tone string `json:"tone,omitempty"`
+	// Deltas adds each predicted month's change from the last actual and
+	// from the previous month
+	Deltas bool `json:"deltas,omitempty"`
+	// SkipGrowthPeriods leaves the first N historical months out of the
+	// growth rates, e.g. a near-zero launch month; totals still include them
+	SkipGrowthPeriods int `json:"skip_growth_periods,omitempty"`
+	// IncomeCeiling is the monthly income capacity the business cannot
+	// exceed; when set income saturates toward it instead of compounding
+	IncomeCeiling float64 `json:"income_ceiling,omitempty"`
+	// IncomeGrowthOverride and ExpenseGrowthOverride are monthly growth
+	// rates supplied by the analyst, e.g. from a signed contract; when set
+	// they replace the rate measured from the history
+	IncomeGrowthOverride  *float64 `json:"income_growth_override,omitempty"`
+	ExpenseGrowthOverride *float64 `json:"expense_growth_override,omitempty"`
+	// ExpenseCapRatio holds each predicted month's expense to this fraction
+	// of its predicted income, a cost-discipline scenario; 0 leaves it off
+	ExpenseCapRatio float64 `json:"expense_cap_ratio,omitempty"`
+	// ReinvestmentRate is the share of net flow put back into the business,
+	// used for the sustainable growth rate; nil means all of it
+	ReinvestmentRate *float64 `json:"reinvestment_rate,omitempty"`
+	// SkipRecommendations leaves the recommendation lists empty for
+	// high-volume scoring; the metrics and verdicts are still computed
+	SkipRecommendations bool `json:"skip_recommendations,omitempty"`
+	// FanLevels are the confidence levels, e.g. 0.5, 0.8 and 0.95, of the
+	// fan chart bands added to every predicted month
+	FanLevels []float64 `json:"fan_levels,omitempty"`
+	// ModelParams tunes the selected model, e.g. {"trend_damping": 0.8};
+	// modelParamSpecs lists what each model accepts
+	ModelParams map[string]float64 `json:"model_params,omitempty"`
+	// NetFlowMode is components (default), deriving net flow from the
+	// income and expense forecasts, or direct, forecasting the net flow
+	// series on its own
+	NetFlowMode string `json:"net_flow_mode,omitempty"`
+	// Order is asc (default) or desc; desc returns the monthly arrays most
+	// recent first. The computation itself is always chronological.
+	Order string `json:"order,omitempty"`
+	// IncludeSeasonallyAdjusted adds the history with seasonality removed
+	IncludeSeasonallyAdjusted bool `json:"include_seasonally_adjusted,omitempty"`
+	// Simulations is the number of Monte Carlo paths behind break_even;
+	// 0 skips the simulation
+	Simulations int `json:"simulations,omitempty"`
+	// ForecastUntil is the last month to forecast as an ISO month, e.g.
+	// 2025-12; empty forecasts forecastHorizon months
+	ForecastUntil string `json:"forecast_until,omitempty"`
 }
 
-// FinancialAnalyzer handles the prediction logic
-type FinancialAnalyzer struct {
-	// In a real application, this could connect to a database
-}
+// Request schema versions. Version 1 predates the geometric growth default,
+// so its payloads keep the arithmetic mean unless growth_method says otherwise.
+const (
+	schemaVersion1      = 1
+	schemaVersion2      = 2
+	latestSchemaVersion = schemaVersion2
+)
 
-// PredictNext6Months generates predictions based on historical data
-func (fa *FinancialAnalyzer) PredictNext6Months(historical []FinancialData) []FinancialData {
-	predictions := make([]FinancialData, 6)
+// supportedSchemaVersions lists the accepted AnalysisRequest.SchemaVersion values
+var supportedSchemaVersions = []int{schemaVersion1, schemaVersion2}
 
-	if len(historical) == 0 {
-		return predictions
+// applySchemaDefaults fills in the defaults of the request's schema version
+// and pins the version, so version 1 clients are not silently reinterpreted
+// when a default changes
+func applySchemaDefaults(req *AnalysisRequest) {
+	if req.SchemaVersion == 0 {
+		req.SchemaVersion = latestSchemaVersion
 	}
+	if req.SchemaVersion == schemaVersion1 && req.GrowthMethod == "" {
+		req.GrowthMethod = growthArithmetic
+	}
+}
 
-	// Calculate trends and seasonal patterns
-	incomeGrowthRate := fa.calculateGrowthRate(historical, "income")
-	expenseGrowthRate := fa.calculateGrowthRate(historical, "expense")
+// AnalyzerConfig holds the tunable settings of the analyzer
+type AnalyzerConfig struct {
+	SectorBenchmarks map[string]SectorBenchmark `json:"sector_benchmarks"`
+	// CacheSize is the number of analyses kept in the LRU cache
+	CacheSize int `json:"cache_size"`
+	// StoreSize caps the analyses kept for rerun and actuals, and the
+	// companies whose comparisons are kept, evicting the least recently
+	// used; 0 means unbounded. Server-wide, read at startup.
+	StoreSize int `json:"store_size"`
+	// DefaultGrowthRate is the monthly rate assumed when growth cannot be measured
+	DefaultGrowthRate float64 `json:"default_growth_rate"`
+	// SeasonalFactorMin/Max bound seasonal factors computed from the history
+	SeasonalFactorMin float64 `json:"seasonal_factor_min"`
+	SeasonalFactorMax float64 `json:"seasonal_factor_max"`
+	// SeasonalMinHistory is the number of months needed before seasonal
+	// factors are computed from the data instead of the defaults
+	SeasonalMinHistory int `json:"seasonal_min_history"`
+	// SeasonalMinSamples is how many observations a calendar month needs for
+	// its computed factor to be trusted; other months are neutral
+	SeasonalMinSamples int `json:"seasonal_min_samples"`
+	// SeasonalSmoothingWindow is the width of the circular moving average
+	// applied to computed seasonal factors; 0 or 1 (the default) disables it
+	SeasonalSmoothingWindow int `json:"seasonal_smoothing_window"`
+	// MaxBodyBytes caps request bodies; it applies to the whole server, so
+	// tenant configs cannot change it
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// BatchWorkers is the size of the batch worker pool; 0 (the default)
+	// means one worker per CPU. Like MaxBodyBytes it is server-wide, and the
+	// BATCH_WORKERS environment variable overrides it.
+	BatchWorkers int `json:"batch_workers"`
+	// MaxBatchBytes caps the body of /api/batch in place of MaxBodyBytes,
+	// which then applies to each of its requests; server-wide as well
+	MaxBatchBytes int64 `json:"max_batch_bytes"`
+	// HistogramBuckets is the number of equal-width net-flow histogram buckets
+	HistogramBuckets int `json:"histogram_buckets"`
+	// MaxHorizon is the furthest month, counted from the current one, that
+	// forecast_until may name; at most maxHorizonLimit
+	MaxHorizon int `json:"max_horizon"`
+	// ExpenseGrowthFloor is the lowest monthly expense growth the forecast
+	// projects; nil (the default) leaves expense growth unfloored
+	ExpenseGrowthFloor *float64          `json:"expense_growth_floor,omitempty"`
+	Thresholds         VerdictThresholds `json:"thresholds"`
+	// ProfileExpenseFloor is the share of the company's monthly_avg_expense
+	// that predicted expenses are not allowed to fall below; 0 disables it
+	ProfileExpenseFloor float64 `json:"profile_expense_floor"`
+	// MaxStringLength caps the characters of the company's id, name, sector
+	// and currency; 0 removes the limit
+	MaxStringLength int `json:"max_string_length"`
+	// CurrencyMismatch decides what a request whose months or company name
+	// different currencies gets: "warn" (the default) adds a warning,
+	// "error" rejects it
+	CurrencyMismatch string `json:"currency_mismatch,omitempty"`
+	// BankCSV is the default column mapping of bank statement imports
+	BankCSV BankCSVFormat `json:"bank_csv"`
+	// RecommendationRules decide which advice a summary gets; a config that
+	// lists them replaces the built-in set as a whole
+	RecommendationRules []RecommendationRule `json:"recommendation_rules"`
+}
 
-	// Get the last known values as baseline
-	lastData := historical[len(historical)-1]
-	baseIncome := lastData.Income
-	baseExpense := lastData.Expense
+// BankCSVFormat describes a bank's transaction export: the header names of
+// the date, description and amount columns, the Go layout of the dates and
+// the field delimiter. Credits are positive amounts, debits negative.
+type BankCSVFormat struct {
+	DateColumn        string `json:"date_column"`
+	DescriptionColumn string `json:"description_column"`
+	AmountColumn      string `json:"amount_column"`
+	DateFormat        string `json:"date_format"`
+	Delimiter         string `json:"delimiter"`
+}
 
-	// Add seasonal adjustment
-	seasonalFactors := fa.getSeasonalFactors(historical)
+// VerdictThresholds are the ratios behind the summary verdicts
+type VerdictThresholds struct {
+	// Predicted income above/below historical income times these is Yükseliş/Düşüş
+	GrowthUp   float64 `json:"growth_up"`
+	GrowthDown float64 `json:"growth_down"`
+	// Predicted net flow above historical net flow times this is low risk
+	LowRisk float64 `json:"low_risk"`
+	// Average predicted net flow above the historical average times this is strong
+	StrongHealth float64 `json:"strong_health"`
+	// A predicted month whose expense/income ratio exceeds this is flagged
+	ExpenseRatio float64 `json:"expense_ratio"`
+	// Share of historical months with expenses above income that, together
+	// with a declining net flow, raises the possible_swapped_columns warning
+	SwappedColumns float64 `json:"swapped_columns"`
+}
 
-	for i := 0; i < 6; i++ {
-		monthIndex := (len(historical) + i) % 12
-		seasonalFactor := seasonalFactors[monthIndex]
+// defaultSectorBenchmarks is the built-in benchmark table keyed by CompanyProfile.Sector
+var defaultSectorBenchmarks = map[string]SectorBenchmark{
+	"Teknoloji": {MarginLow: 0.15, MarginHigh: 0.30, GrowthLow: 0.01, GrowthHigh: 0.04},
+	"E-ticaret": {MarginLow: 0.08, MarginHigh: 0.20, GrowthLow: 0.01, GrowthHigh: 0.05},
+	"Perakende": {MarginLow: 0.03, MarginHigh: 0.10, GrowthLow: 0.00, GrowthHigh: 0.02},
+	"Üretim":    {MarginLow: 0.06, MarginHigh: 0.15, GrowthLow: 0.00, GrowthHigh: 0.02},
+	"Hizmet":    {MarginLow: 0.10, MarginHigh: 0.25, GrowthLow: 0.00, GrowthHigh: 0.03},
+	"İnşaat":    {MarginLow: 0.05, MarginHigh: 0.12, GrowthLow: -0.01, GrowthHigh: 0.02},
+	"Gıda":      {MarginLow: 0.04, MarginHigh: 0.12, GrowthLow: 0.00, GrowthHigh: 0.02},
+	"Turizm":    {MarginLow: 0.08, MarginHigh: 0.20, GrowthLow: -0.01, GrowthHigh: 0.03},
+}
 
-		// Apply growth rate and seasonal adjustment
-		predictedIncome := baseIncome * math.Pow(1+incomeGrowthRate, float64(i+1)) * seasonalFactor
-		predictedExpense := baseExpense * math.Pow(1+expenseGrowthRate, float64(i+1))
+// defaultConfig returns the built-in analyzer configuration
+func defaultConfig() AnalyzerConfig {
+	benchmarks := make(map[string]SectorBenchmark, len(defaultSectorBenchmarks))
+	for sector, b := range defaultSectorBenchmarks {
+		benchmarks[sector] = b
+	}
+	return AnalyzerConfig{
+		SectorBenchmarks:    benchmarks,
+		CacheSize:           256,
+		StoreSize:           10000,
+		DefaultGrowthRate:   0.02,
+		SeasonalFactorMin:   0.5,
+		SeasonalFactorMax:   2.0,
+		SeasonalMinHistory:  24,
+		SeasonalMinSamples:  2,
+		HistogramBuckets:    5,
+		MaxHorizon:          12,
+		CurrencyMismatch:    currencyMismatchWarn,
+		MaxStringLength:     256,
+		ProfileExpenseFloor: 0.8,
+		MaxBodyBytes:        1 << 20,
+		MaxBatchBytes:       64 << 20,
+		RecommendationRules: slices.Clone(defaultRecommendationRules),
+		BankCSV: BankCSVFormat{
+			DateColumn:        "date",
+			DescriptionColumn: "description",
+			AmountColumn:      "amount",
+			DateFormat:        "2006-01-02",
+			Delimiter:         ",",
+		},
+		Thresholds: VerdictThresholds{
+			GrowthUp:       1.1,
+			GrowthDown:     0.9,
+			LowRisk:        1.2,
+			StrongHealth:   1.5,
+			ExpenseRatio:   0.95,
+			SwappedColumns: 0.8,
+		},
+	}
+}
 
-		// Add some volatility (random factor between 0.9-1.1)
-		volatilityFactor := 0.95 + (float64(i%3) * 0.05) // Simplified volatility
-		predictedIncome *= volatilityFactor
-		predictedExpense *= (2.0 - volatilityFactor) // Inverse for expenses
+// clone returns a copy of c that shares no maps with it
+func (c AnalyzerConfig) clone() AnalyzerConfig {
+	c.SectorBenchmarks = maps.Clone(c.SectorBenchmarks)
+	// Each rule's conditions are copied too: decoding an override into the
+	// clone would otherwise write through to the shared condition arrays
+	c.RecommendationRules = slices.Clone(c.RecommendationRules)
+	for i := range c.RecommendationRules {
+		c.RecommendationRules[i].When = slices.Clone(c.RecommendationRules[i].When)
+	}
+	return c
+}
 
-		predictions[i] = FinancialData{
-			Month:   fa.getMonthName(time.Now().AddDate(0, i+1, 0)),
-			Income:  math.Round(predictedIncome*100) / 100,
-			Expense: math.Round(predictedExpense*100) / 100,
-			NetFlow: math.Round((predictedIncome-predictedExpense)*100) / 100,
-		}
+// loadConfig reads a JSON config file on top of the defaults. Fields present
+// in the file override the defaults; sector benchmarks in the file replace
+// the built-in entry for that sector or add a new one.
+func loadConfig(path string) (AnalyzerConfig, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
 	}
 
-	return predictions
-}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading config: %w", err)
+	}
 
-// calculateGrowthRate calculates monthly growth rate
-func (fa *FinancialAnalyzer) calculateGrowthRate(data []FinancialData, field string) float64 {
-	if len(data) < 2 {
-		return 0.02 // Default 2% growth
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
 	}
 
-	var totalGrowth float64
-	var validPeriods int
+	return cfg, nil
+}
 
-	for i := 1; i < len(data); i++ {
-		var current, previous float64
+// Tenant is a customer with its own analyzer configuration, identified by API key
+type Tenant struct {
+	ID     string         `json:"id"`
+	APIKey string         `json:"api_key"`
+	Config AnalyzerConfig `json:"-"`
+}
 
-		if field == "income" {
-			current = data[i].Income
-			previous = data[i-1].Income
-		} else {
-			current = data[i].Expense
-			previous = data[i-1].Expense
-		}
+// loadTenants reads the tenants file. Each tenant's "config" is applied on top
+// of base, so a tenant only lists the settings it changes.
+func loadTenants(path string, base AnalyzerConfig) (map[string]Tenant, error) {
+	tenants := make(map[string]Tenant)
+	if path == "" {
+		return tenants, nil
+	}
 
-		if previous > 0 {
-			growth := (current - previous) / previous
-			totalGrowth += growth
-			validPeriods++
-		}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tenants: %w", err)
 	}
 
-	if validPeriods == 0 {
-		return 0.02
+	var file struct {
+		Tenants []struct {
+			Tenant
+			Config json.RawMessage `json:"config"`
+		} `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing tenants %s: %w", path, err)
 	}
 
-	avgGrowthRate := totalGrowth / float64(validPeriods)
+	for _, t := range file.Tenants {
+		if t.APIKey == "" {
+			return nil, fmt.Errorf("tenant %q has no api_key", t.ID)
+		}
 
-	// Cap growth rate between -20% and +30% monthly
-	if avgGrowthRate > 0.30 {
-		avgGrowthRate = 0.30
-	} else if avgGrowthRate < -0.20 {
-		avgGrowthRate = -0.20
+		tenant := t.Tenant
+		tenant.Config = base.clone()
+		if len(t.Config) > 0 {
+			if err := json.Unmarshal(t.Config, &tenant.Config); err != nil {
+				return nil, fmt.Errorf("parsing config of tenant %q: %w", t.ID, err)
+			}
+			if err := validateConfig(tenant.Config); err != nil {
+				return nil, fmt.Errorf("config of tenant %q: %w", t.ID, err)
+			}
+		}
+		tenants[tenant.APIKey] = tenant
 	}
 
-	return avgGrowthRate
+	return tenants, nil
 }
 
-// getSeasonalFactors returns seasonal adjustment factors
-func (fa *FinancialAnalyzer) getSeasonalFactors(data []FinancialData) []float64 {
-	// Default seasonal factors (can be calculated from historical data)
-	factors := []float64{
-		1.0, 0.95, 1.05, 1.1, 1.15, 1.2, // Jan-Jun
-		1.25, 1.2, 1.1, 1.05, 1.0, 1.3, // Jul-Dec (Dec higher for year-end)
-	}
+// FinancialAnalyzer handles the prediction logic
+type FinancialAnalyzer struct {
+	// In a real application, this could connect to a database
+	Config AnalyzerConfig
 
-	// In a more sophisticated version, calculate actual seasonal patterns
-	if len(data) >= 12 {
-		// Calculate seasonal patterns from historical data
-		monthlyAvgs := make([]float64, 12)
-		monthlyCounts := make([]int, 12)
+	cache *analysisCache
+	store *analysisStore
+	audit *auditLog
 
-		for _, d := range data {
-			month := fa.getMonthIndex(d.Month)
-			if month >= 0 && month < 12 {
-				monthlyAvgs[month] += d.Income
-				monthlyCounts[month]++
-			}
-		}
+	// Clock returns the current time; tests can freeze it for golden output
+	Clock func() time.Time
 
-		totalAvg := 0.0
-		validMonths := 0
+	// Predictor replaces the built-in models when set, e.g. with a stub in
+	// tests or a client's proprietary method
+	Predictor Predictor
 
-		for i := 0; i < 12; i++ {
-			if monthlyCounts[i] > 0 {
-				monthlyAvgs[i] /= float64(monthlyCounts[i])
-				totalAvg += monthlyAvgs[i]
-				validMonths++
-			}
-		}
+	// tenants maps API keys to tenants; tenantID is set on per-request copies
+	tenants  map[string]Tenant
+	tenantID string
 
-		if validMonths > 0 {
-			totalAvg /= float64(validMonths)
+	// settings holds the live config, tenants and cache, swapped by Reload;
+	// forRequest copies them so a request keeps the settings it started with
+	settings *atomic.Pointer[analyzerSettings]
+}
 
-			for i := 0; i < 12; i++ {
-				if monthlyCounts[i] > 0 {
-					factors[i] = monthlyAvgs[i] / totalAvg
-				}
-			}
-		}
+// analyzerSettings is the part of the analyzer that can be reloaded at runtime
+type analyzerSettings struct {
+	config  AnalyzerConfig
+	tenants map[string]Tenant
+	cache   *analysisCache
+}
+
+// NewFinancialAnalyzer creates an analyzer with its cache and store
+func NewFinancialAnalyzer(config AnalyzerConfig, tenants map[string]Tenant) *FinancialAnalyzer {
+	fa := &FinancialAnalyzer{
+		Config:   config,
+		cache:    newAnalysisCache(config.CacheSize),
+		store:    newAnalysisStore(config.StoreSize),
+		audit:    newAuditLog(),
+		Clock:    time.Now,
+		tenants:  tenants,
+		settings: new(atomic.Pointer[analyzerSettings]),
 	}
+	fa.settings.Store(&analyzerSettings{config: config, tenants: tenants, cache: fa.cache})
+	return fa
+}
 
-	return factors
+// Reload atomically replaces the config and tenants used by new requests.
+// The cache starts empty, as its analyses were computed with the old config.
+func (fa *FinancialAnalyzer) Reload(config AnalyzerConfig, tenants map[string]Tenant) {
+	fa.settings.Store(&analyzerSettings{
+		config:  config,
+		tenants: tenants,
+		cache:   newAnalysisCache(config.CacheSize),
+	})
 }
 
-// getMonthIndex returns month index (0-11)
-func (fa *FinancialAnalyzer) getMonthIndex(monthName string) int {
-	months := []string{
-		"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
-		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık",
+// now returns the analyzer clock's time in UTC, falling back to the real
+// clock. Every timestamp the analyzer stores is UTC; handlers convert to the
+// client's tz only when rendering.
+func (fa *FinancialAnalyzer) now() time.Time {
+	if fa.Clock == nil {
+		return time.Now().UTC()
 	}
+	return fa.Clock().UTC()
+}
 
-	for i, month := range months {
-		if month == monthName {
-			return i
-		}
+// analysisETag hashes what a client sees of analysis in format. The id and
+// created_at differ on every call, so they are left out: an unchanged
+// forecast keeps its ETag between polls.
+func analysisETag(analysis *FinancialAnalysis, format string) (string, error) {
+	content := *analysis
+	content.ID = ""
+	content.CreatedAt = time.Time{}
+	payload, err := json.Marshal(content)
+	if err != nil {
+		return "", err
 	}
-	return -1
+
+	h := sha256.New()
+	h.Write([]byte(format))
+	h.Write(payload)
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`, nil
 }
 
-// getMonthName returns Turkish month name
-func (fa *FinancialAnalyzer) getMonthName(t time.Time) string {
-	months := []string{
-		"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
-		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık",
+// etagMatches reports whether an If-None-Match header lists etag or is "*".
+// Weak validators match their strong form.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
 	}
-	return months[t.Month()-1]
+	return false
 }
 
-// GenerateAnalysis creates a complete financial analysis
-func (fa *FinancialAnalyzer) GenerateAnalysis(req AnalysisRequest) *FinancialAnalysis {
-	predictions := fa.PredictNext6Months(req.HistoricalData)
-	summary := fa.generateSummary(req.HistoricalData, predictions)
+// requestZone returns the time zone named by the tz query parameter (an IANA
+// name such as Europe/Istanbul), or UTC when it is absent
+func requestZone(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
 
-	return &FinancialAnalysis{
-		Company:        req.Company,
-		HistoricalData: req.HistoricalData,
-		Predictions:    predictions,
-		Summary:        summary,
-		CreatedAt:      time.Now(),
+// inZone returns a copy of analysis with CreatedAt rendered in loc, leaving
+// the stored analysis in UTC
+func inZone(analysis *FinancialAnalysis, loc *time.Location) *FinancialAnalysis {
+	if analysis == nil {
+		return nil
 	}
+	local := *analysis
+	local.CreatedAt = analysis.CreatedAt.In(loc)
+	return &local
 }
 
-// generateSummary creates analysis summary
-func (fa *FinancialAnalyzer) generateSummary(historical, predicted []FinancialData) AnalysisSummary {
-	var histIncome, histExpense, histNetFlow float64
-	var predIncome, predExpense, predNetFlow float64
+// Output orders selectable through AnalysisRequest.Order
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
 
-	// Calculate totals
-	for _, h := range historical {
-		histIncome += h.Income
-		histExpense += h.Expense
-		histNetFlow += h.NetFlow
+// inOrder returns analysis with its historical_data, predictions and
+// seasonally_adjusted_history most recent first when order is desc. The
+// arrays are copied, leaving the stored and cached analysis chronological.
+func inOrder(analysis *FinancialAnalysis, order string) *FinancialAnalysis {
+	if analysis == nil || order != orderDesc {
+		return analysis
 	}
-
-	for _, p := range predicted {
-		predIncome += p.Income
-		predExpense += p.Expense
-		predNetFlow += p.NetFlow
+	ordered := *analysis
+	reverse := func(months []FinancialData) []FinancialData {
+		months = slices.Clone(months)
+		slices.Reverse(months)
+		return months
 	}
+	ordered.HistoricalData = reverse(analysis.HistoricalData)
+	ordered.Predictions = reverse(analysis.Predictions)
+	ordered.SeasonallyAdjustedHistory = slices.Clone(analysis.SeasonallyAdjustedHistory)
+	slices.Reverse(ordered.SeasonallyAdjustedHistory)
+	return &ordered
+}
 
-	// Determine trends and health
-	growthTrend := "Stabil"
-	if predIncome > histIncome*1.1 {
-		growthTrend = "Yükseliş"
-	} else if predIncome < histIncome*0.9 {
-		growthTrend = "Düşüş"
+// forRequest returns the analyzer to use for r: a copy carrying the current
+// settings, with the config of the tenant owning the X-API-Key header
+func (fa *FinancialAnalyzer) forRequest(r *http.Request) *FinancialAnalyzer {
+	scoped := *fa
+	if fa.settings != nil {
+		s := fa.settings.Load()
+		scoped.Config, scoped.tenants, scoped.cache = s.config, s.tenants, s.cache
 	}
 
-	riskLevel := "Orta"
-	if predNetFlow < 0 {
-		riskLevel = "Yüksek"
-	} else if predNetFlow > histNetFlow*1.2 {
-		riskLevel = "Düşük"
+	if tenant, ok := scoped.tenants[r.Header.Get("X-API-Key")]; ok {
+		scoped.Config = tenant.Config
+		scoped.tenantID = tenant.ID
 	}
+	return &scoped
+}
 
-	cashFlowHealth := "Normal"
-	avgNetFlow := predNetFlow / 6
-	if avgNetFlow < 0 {
-		cashFlowHealth = "Risk"
-	} else if avgNetFlow > histNetFlow/float64(len(historical))*1.5 {
-		cashFlowHealth = "Güçlü"
-	}
+// RerunRequest selects what changes when a stored analysis is replayed
+type RerunRequest struct {
+	// Model replaces the stored request's model when set
+	Model string `json:"model"`
+	// Config is applied on top of the analyzer config for this run only
+	Config json.RawMessage `json:"config"`
+}
 
-	// Generate recommendations
-	recommendations := fa.generateRecommendations(growthTrend, riskLevel, cashFlowHealth, predNetFlow)
+// ActualsRequest carries the realized months reported after a forecast
+type ActualsRequest struct {
+	Actuals []FinancialData `json:"actuals"`
+}
 
-	return AnalysisSummary{
-		TotalHistoricalIncome:  math.Round(histIncome*100) / 100,
-		TotalHistoricalExpense: math.Round(histExpense*100) / 100,
-		TotalHistoricalNetFlow: math.Round(histNetFlow*100) / 100,
-		PredictedTotalIncome:   math.Round(predIncome*100) / 100,
-		PredictedTotalExpense:  math.Round(predExpense*100) / 100,
-		PredictedTotalNetFlow:  math.Round(predNetFlow*100) / 100,
-		GrowthTrend:            growthTrend,
-		RiskLevel:              riskLevel,
-		CashFlowHealth:         cashFlowHealth,
-		Recommendations:        recommendations,
-	}
+// MonthlyForecastError compares one predicted month with what actually happened.
+// Errors are actual minus predicted; percentages are relative to the prediction.
+type MonthlyForecastError struct {
+	Month            string  `json:"month"`
+	PredictedIncome  float64 `json:"predicted_income"`
+	ActualIncome     float64 `json:"actual_income"`
+	IncomeError      float64 `json:"income_error"`
+	IncomeErrorPct   float64 `json:"income_error_pct"`
+	PredictedExpense float64 `json:"predicted_expense"`
+	ActualExpense    float64 `json:"actual_expense"`
+	ExpenseError     float64 `json:"expense_error"`
+	ExpenseErrorPct  float64 `json:"expense_error_pct"`
+	PredictedNetFlow float64 `json:"predicted_net_flow"`
+	ActualNetFlow    float64 `json:"actual_net_flow"`
+	NetFlowError     float64 `json:"net_flow_error"`
+
+	// modelIncome and modelExpense are the model's output for the month
+	// before the bias correction and later adjustments; the bias is learned
+	// against them, so an applied correction does not cancel itself out
+	modelIncome, modelExpense float64
+}
+
+// ActualsComparison is the stored forecast-vs-actual result for one analysis
+type ActualsComparison struct {
+	AnalysisID      string                 `json:"analysis_id"`
+	CompanyID       string                 `json:"company_id"`
+	Months          []MonthlyForecastError `json:"months"`
+	UnmatchedMonths []string               `json:"unmatched_months,omitempty"`
+	MAPE            float64                `json:"mape"`
+	Accuracy        string                 `json:"accuracy"`
+	ComparedAt      time.Time              `json:"compared_at"`
+}
+
+// CompanyAccuracy tracks a company's forecast accuracy across comparisons
+type CompanyAccuracy struct {
+	CompanyID   string  `json:"company_id"`
+	Comparisons int     `json:"comparisons"`
+	AverageMAPE float64 `json:"average_mape"`
+}
+
+// BiasCorrection is the per-company factor applied to the model output to
+// cancel its systematic over- or under-prediction. Factors are total actual
+// over total predicted across every month compared so far.
+type BiasCorrection struct {
+	IncomeFactor  float64 `json:"income_factor"`
+	ExpenseFactor float64 `json:"expense_factor"`
+	SampleMonths  int     `json:"sample_months"`
+}
+
+// Bias correction is applied once a company has this many compared months,
+// with each factor kept within the given range
+const (
+	minBiasSamples = 3
+	minBiasFactor  = 0.5
+	maxBiasFactor  = 1.5
+)
+
+// storedAnalysis keeps an analysis together with the request that produced it
+type storedAnalysis struct {
+	Request  AnalysisRequest
+	Analysis *FinancialAnalysis
+}
+
+// maxStoredComparisons is how many actuals comparisons the store keeps per
+// company; older ones are dropped first
+const maxStoredComparisons = 100
+
+// analysisStore keeps analyses and their actuals comparisons in memory. It
+// holds at most capacity analyses and the comparisons of at most capacity
+// companies, evicting the least recently used when full.
+type analysisStore struct {
+	mu          sync.Mutex
+	capacity    int
+	analyses    *lruMap[storedAnalysis]
+	comparisons *lruMap[companyComparisons] // by company ID
 }
 
-// generateRecommendations creates actionable recommendations
-func (fa *FinancialAnalyzer) generateRecommendations(growth, risk, health string, netFlow float64) []string {
-	var recommendations []string
+// companyComparisons holds a company's comparisons, one per analysis.
+// Revision counts the changes, so cached analyses see a new bias.
+type companyComparisons struct {
+	History  []ActualsComparison
+	Revision int
+}
 
-	if risk == "Yüksek" {
-		recommendations = append(recommendations, "Acil nakit akış planı oluşturun")
-		recommendations = append(recommendations, "Gereksiz giderleri kısmayı düşünün")
-		recommendations = append(recommendations, "Alternatif finansman kaynaklarını araştırın")
+func newAnalysisStore(capacity int) *analysisStore {
+	return &analysisStore{
+		capacity:    capacity,
+		analyses:    newLRUMap[storedAnalysis](capacity),
+		comparisons: newLRUMap[companyComparisons](capacity),
 	}
+}
+
+// Save stores analysis under its ID
+func (s *analysisStore) Save(req AnalysisRequest, analysis *FinancialAnalysis) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.analyses.Put(analysis.ID, storedAnalysis{Request: req, Analysis: analysis})
+}
+
+// Get returns the stored analysis with the given ID
+func (s *analysisStore) Get(id string) (storedAnalysis, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.analyses.Get(id)
+}
+
+// Len returns how many analyses are stored
+func (s *analysisStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.analyses.Len()
+}
 
-	if growth == "Düşüş" {
-		recommendations = append(recommendations, "Yeni pazarlama stratejileri geliştirin")
-		recommendations = append(recommendations, "Maliyet optimizasyonu yapın")
-		recommendations = append(recommendations, "Ürün/hizmet portföyünüzü gözden geçirin")
+// Comparison returns the comparison recorded for an analysis of a company
+func (s *analysisStore) Comparison(companyID, analysisID string) (ActualsComparison, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, _ := s.comparisons.Get(companyID)
+	i := slices.IndexFunc(company.History, func(c ActualsComparison) bool { return c.AnalysisID == analysisID })
+	if i < 0 {
+		return ActualsComparison{}, false
 	}
+	return company.History[i], true
+}
 
-	if health == "Güçlü" {
-		recommendations = append(recommendations, "Yatırım fırsatlarını değerlendirin")
-		recommendations = append(recommendations, "Büyüme stratejileri planlayın")
-		recommendations = append(recommendations, "Acil durum fonu oluşturun")
+// AddComparison records a comparison, replacing an earlier one of the same
+// analysis, and returns the company's updated accuracy
+func (s *analysisStore) AddComparison(c ActualsComparison) CompanyAccuracy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, _ := s.comparisons.Get(c.CompanyID)
+	history := slices.DeleteFunc(slices.Clone(company.History), func(h ActualsComparison) bool {
+		return h.AnalysisID == c.AnalysisID
+	})
+	history = append(history, c)
+	if len(history) > maxStoredComparisons {
+		history = slices.Clone(history[len(history)-maxStoredComparisons:])
 	}
+	s.comparisons.Put(c.CompanyID, companyComparisons{History: history, Revision: company.Revision + 1})
 
-	if netFlow > 0 {
-		recommendations = append(recommendations, "Kâr paylaşım planı düşünün")
+	var totalMAPE float64
+	for _, h := range history {
+		totalMAPE += h.MAPE
 	}
 
-	if len(recommendations) == 0 {
-		recommendations = append(recommendations, "Mevcut performansınızı korumaya odaklanın")
+	return CompanyAccuracy{
+		CompanyID:   c.CompanyID,
+		Comparisons: len(history),
+		AverageMAPE: math.Round(totalMAPE/float64(len(history))*10000) / 10000,
 	}
+}
 
-	return recommendations
+// ComparisonRevision returns how many times a company's comparisons changed
+func (s *analysisStore) ComparisonRevision(companyID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	company, _ := s.comparisons.Get(companyID)
+	return company.Revision
 }
 
-// CORS middleware
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// Bias derives the company's bias correction from its actuals comparisons.
+// Returns nil until minBiasSamples months have been compared.
+func (s *analysisStore) Bias(companyID string) *BiasCorrection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	var predictedIncome, actualIncome, predictedExpense, actualExpense float64
+	samples := 0
+	company, _ := s.comparisons.Get(companyID)
+	for _, c := range company.History {
+		for _, m := range c.Months {
+			predictedIncome += m.modelIncome
+			actualIncome += m.ActualIncome
+			predictedExpense += m.modelExpense
+			actualExpense += m.ActualExpense
+			samples++
 		}
+	}
+	if samples < minBiasSamples {
+		return nil
+	}
 
-		next.ServeHTTP(w, r)
+	factor := func(actual, predicted float64) float64 {
+		if predicted <= 0 {
+			return 1
+		}
+		f := math.Max(minBiasFactor, math.Min(actual/predicted, maxBiasFactor))
+		return math.Round(f*10000) / 10000
+	}
+	return &BiasCorrection{
+		IncomeFactor:  factor(actualIncome, predictedIncome),
+		ExpenseFactor: factor(actualExpense, predictedExpense),
+		SampleMonths:  samples,
 	}
 }
 
-// HTTP Handlers
-func (fa *FinancialAnalyzer) analyzeHandler(w http.ResponseWriter, r *http.Request) {
-	// Debug log
-	fmt.Printf("Method: %s, URL: %s\n", r.Method, r.URL.Path)
+// lruMap is a map that keeps at most capacity entries, evicting the least
+// recently used; capacity 0 or less means unbounded. It is not safe for
+// concurrent use.
+type lruMap[V any] struct {
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
 
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", "POST")
-		http.Error(w, "Method not allowed. Use POST", http.StatusMethodNotAllowed)
-		return
-	}
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
 
-	var req AnalysisRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
-		return
+func newLRUMap[V any](capacity int) *lruMap[V] {
+	return &lruMap[V]{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the value of key and marks it as recently used
+func (m *lruMap[V]) Get(key string) (V, bool) {
+	elem, ok := m.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
 	}
+	m.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[V]).value, true
+}
 
-	// Validate input
-	if len(req.HistoricalData) == 0 {
-		http.Error(w, "Historical data is required", http.StatusBadRequest)
+// Put sets the value of key, evicting the least recently used entry when full
+func (m *lruMap[V]) Put(key string, value V) {
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*lruEntry[V]).value = value
+		m.order.MoveToFront(elem)
 		return
 	}
 
-	// Calculate net flows if not provided
-	for i := range req.HistoricalData {
-		req.HistoricalData[i].NetFlow = req.HistoricalData[i].Income - req.HistoricalData[i].Expense
+	m.entries[key] = m.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if m.capacity > 0 && m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*lruEntry[V]).key)
 	}
+}
 
-	analysis := fa.GenerateAnalysis(req)
+// Len returns the number of entries
+func (m *lruMap[V]) Len() int {
+	return m.order.Len()
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(analysis); err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		return
-	}
+// newAnalysisID returns a random identifier for a stored analysis
+func newAnalysisID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-// healthHandler provides health check endpoint
-func (fa *FinancialAnalyzer) healthHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("Health check - Method: %s\n", r.Method)
+// analysisCache is a fixed-size LRU cache of analyses keyed by request hash
+type analysisCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+	hits     uint64
+	misses   uint64
+}
 
-	w.Header().Set("Content-Type", "application/json")
+type cacheEntry struct {
+	key      string
+	analysis *FinancialAnalysis
+}
+
+// CacheStats reports the cache counters exposed by the metrics endpoint
+type CacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+func newAnalysisCache(capacity int) *analysisCache {
+	return &analysisCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached analysis for key and marks it as recently used
+func (c *analysisCache) Get(key string) (*FinancialAnalysis, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).analysis, true
+}
+
+// Add stores analysis under key, evicting the least recently used entry when full
+func (c *analysisCache) Add(key string, analysis *FinancialAnalysis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).analysis = analysis
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, analysis: analysis})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *analysisCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Size:     c.order.Len(),
+		Capacity: c.capacity,
+	}
+}
+
+// Forecast models selectable through AnalysisRequest.Model
+const (
+	modelCompound     = "compound"
+	modelConservative = "conservative"
+	modelDecompose    = "decompose"
+)
+
+// supportedModels lists the accepted AnalysisRequest.Model values
+var supportedModels = []string{modelCompound, modelConservative, modelDecompose}
+
+// Net flow modes selectable through AnalysisRequest.NetFlowMode
+const (
+	netFlowComponents = "components"
+	netFlowDirect     = "direct"
+)
+
+// Decomposition modes selectable through AnalysisRequest.DecompositionMode
+const (
+	decomposeMultiplicative = "multiplicative"
+	decomposeAdditive       = "additive"
+)
+
+// Growth-rate aggregation methods selectable through AnalysisRequest.GrowthMethod
+const (
+	growthArithmetic = "arithmetic"
+	growthGeometric  = "geometric"
+)
+
+// supportedGrowthMethods lists the accepted AnalysisRequest.GrowthMethod values
+var supportedGrowthMethods = []string{growthArithmetic, growthGeometric}
+
+// Zero-income handling policies selectable through AnalysisRequest.ZeroIncomePolicy
+const (
+	zeroIncomeInclude = "include"
+	zeroIncomeExclude = "exclude"
+)
+
+// growthOptions control how calculateGrowthRate aggregates a series
+type growthOptions struct {
+	Method string
+	// ExcludeZeroIncome drops zero-income months from the income trend
+	ExcludeZeroIncome bool
+	// SkipPeriods leaves the first months, e.g. a launch ramp-up, out of the trend
+	SkipPeriods int
+}
+
+// growthOptionsFor returns the growth options requested by req. The geometric
+// mean is the default for the compound model since it gives the true compound
+// rate; other models keep the arithmetic mean unless asked otherwise.
+func growthOptionsFor(req AnalysisRequest) growthOptions {
+	opts := growthOptions{
+		Method:            req.GrowthMethod,
+		ExcludeZeroIncome: req.ZeroIncomePolicy == zeroIncomeExclude,
+		SkipPeriods:       req.SkipGrowthPeriods,
+	}
+
+	if opts.Method == "" {
+		opts.Method = growthArithmetic
+		if req.Model == "" || req.Model == modelCompound {
+			opts.Method = growthGeometric
+		}
+	}
+
+	return opts
+}
+
+// Growth rate sources reported in AnalysisSummary
+const (
+	growthComputed = "computed"
+	growthOverride = "override"
+	// growthDecomposed is the average monthly growth of the decompose
+	// model's extrapolated trend
+	growthDecomposed = "decomposed"
+)
+
+// ModelParamSpec describes a model_params entry: its default and the
+// inclusive range it must lie in
+type ModelParamSpec struct {
+	Default float64 `json:"default"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// Model parameter names
+const (
+	paramSeasonalStrength    = "seasonal_strength"
+	paramVolatilityAmplitude = "volatility_amplitude"
+	paramTrendDamping        = "trend_damping"
+)
+
+// modelParamSpecs lists the model_params each model reads.
+// seasonal_strength scales how far the seasonal factors depart from
+// neutral (0 removes seasonality, 2 doubles it); volatility_amplitude is the
+// swing of the alternating volatility pattern of the compound forecast;
+// trend_damping flattens the decomposed trend step by step (1 keeps it
+// linear, 0.8 makes each month's trend step 80% of the previous one).
+var modelParamSpecs = map[string]map[string]ModelParamSpec{
+	modelCompound: {
+		paramSeasonalStrength:    {Default: 1, Min: 0, Max: 2},
+		paramVolatilityAmplitude: {Default: 0.05, Min: 0, Max: 0.2},
+	},
+	modelConservative: {
+		paramSeasonalStrength:    {Default: 1, Min: 0, Max: 2},
+		paramVolatilityAmplitude: {Default: 0.05, Min: 0, Max: 0.2},
+	},
+	modelDecompose: {
+		paramSeasonalStrength: {Default: 1, Min: 0, Max: 2},
+		paramTrendDamping:     {Default: 1, Min: 0, Max: 1},
+	},
+}
+
+// modelParam returns the value of name for model: the request's value when
+// given and accepted by the model, otherwise the model's default, falling
+// back to the compound model's default for parameters the model does not read
+func modelParam(req AnalysisRequest, model, name string) float64 {
+	spec, accepted := modelParamSpecs[cmp.Or(model, modelCompound)][name]
+	if !accepted {
+		return modelParamSpecs[modelCompound][name].Default
+	}
+	if v, ok := req.ModelParams[name]; ok {
+		return v
+	}
+	return spec.Default
+}
+
+// validateModelParams checks that every model_params entry is read by one of
+// the selected models and lies in its range
+func validateModelParams(req AnalysisRequest) error {
+	incomeModel, expenseModel := seriesModels(req)
+	models := slices.Compact([]string{cmp.Or(incomeModel, modelCompound), cmp.Or(expenseModel, modelCompound)})
+	for _, name := range slices.Sorted(maps.Keys(req.ModelParams)) {
+		v := req.ModelParams[name]
+		accepted := false
+		for _, model := range models {
+			spec, ok := modelParamSpecs[model][name]
+			if !ok {
+				continue
+			}
+			accepted = true
+			if !(v >= spec.Min && v <= spec.Max) {
+				return &FieldError{Field: "model_params." + name, Err: fmt.Errorf("%w: %s must be between %g and %g for the %s model", ErrInvalidModelParam, name, spec.Min, spec.Max, model)}
+			}
+		}
+		if !accepted {
+			return &FieldError{Field: "model_params." + name, Err: fmt.Errorf("%w: %s is not a parameter of the %s model", ErrInvalidModelParam, name, strings.Join(models, "/"))}
+		}
+	}
+	return nil
+}
+
+// forecastParams are the inputs the forecast is run with
+type forecastParams struct {
+	IncomeGrowthRate  float64
+	ExpenseGrowthRate float64
+	// IncomeGrowthSource and ExpenseGrowthSource tell whether each rate was
+	// measured from the history or supplied by the request
+	IncomeGrowthSource  string
+	ExpenseGrowthSource string
+	// MaxSeasonalFactor caps the seasonal uplift applied to income
+	MaxSeasonalFactor float64
+	// SkipSeasonality disables seasonal adjustment for pre-adjusted input
+	SkipSeasonality bool
+	// FiscalYearStartMonth aligns positional month indexing with the calendar
+	FiscalYearStartMonth int
+	// IncomeCeiling switches income growth to a logistic curve saturating at
+	// this monthly income; 0 means unbounded compounding
+	IncomeCeiling float64
+	// SeasonalStrength and VolatilityAmplitude come from model_params
+	SeasonalStrength    float64
+	VolatilityAmplitude float64
+	// ProfileIncome and ProfileExpense are the company's stated monthly
+	// averages, blended into the baseline of a short history; 0 means none
+	ProfileIncome  float64
+	ProfileExpense float64
+}
+
+// forecastHorizon is the number of months the analysis forecasts unless the
+// request sets forecast_until
+const forecastHorizon = 6
+
+// lastHistoricalMonth dates the last month of historical, which only names
+// its month: it is the latest such month not after the current one. A
+// history without a recognised last month ends in the current month.
+func (fa *FinancialAnalyzer) lastHistoricalMonth(historical []FinancialData) time.Time {
+	now := fa.now()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if len(historical) == 0 {
+		return current
+	}
+	month := fa.getMonthIndex(historical[len(historical)-1].Month)
+	if month < 0 {
+		return current
+	}
+	return current.AddDate(0, -((int(now.Month()) - 1 - month + 12) % 12), 0)
+}
+
+// forecastUntilMonths returns the number of months from the last month of
+// historical through until, an ISO month such as 2025-12. The forecast
+// starts the month after the history, so until must lie after it and within
+// MaxHorizon. An empty until means forecastHorizon.
+func (fa *FinancialAnalyzer) forecastUntilMonths(historical []FinancialData, until string) (int, error) {
+	if until == "" {
+		return forecastHorizon, nil
+	}
+	target, err := time.Parse("2006-01", until)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not an ISO month like 2025-12", ErrInvalidMonth, until)
+	}
+	last := fa.lastHistoricalMonth(historical)
+	months := (target.Year()-last.Year())*12 + int(target.Month()) - int(last.Month())
+	if months < 1 {
+		return 0, fmt.Errorf("%w: %s must be after the last historical month %s", ErrInvalidMonth, until, last.Format("2006-01"))
+	}
+	if months > fa.Config.MaxHorizon {
+		return 0, fmt.Errorf("%w: %s is %d months ahead; the maximum horizon is %d", ErrInvalidMonth, until, months, fa.Config.MaxHorizon)
+	}
+	return months, nil
+}
+
+// horizon returns the number of months req forecasts. An invalid
+// forecast_until, which Validate rejects, falls back to forecastHorizon.
+func (fa *FinancialAnalyzer) horizon(req AnalysisRequest) int {
+	months, err := fa.forecastUntilMonths(req.HistoricalData, req.ForecastUntil)
+	if err != nil {
+		return forecastHorizon
+	}
+	return months
+}
+
+// Predictor forecasts the n months following historical
+type Predictor interface {
+	Predict(historical []FinancialData, n int) []FinancialData
+}
+
+// compoundPredictor runs the growth-and-seasonality forecast with fixed
+// parameters; it backs both the compound and the conservative model
+type compoundPredictor struct {
+	fa     *FinancialAnalyzer
+	params forecastParams
+}
+
+// Predict implements Predictor
+func (p compoundPredictor) Predict(historical []FinancialData, n int) []FinancialData {
+	return p.fa.predictWithParams(historical, p.params, n)
+}
+
+// decomposePredictor runs the trend/seasonal decomposition model
+type decomposePredictor struct {
+	fa  *FinancialAnalyzer
+	req AnalysisRequest
+}
+
+// Predict implements Predictor
+func (p decomposePredictor) Predict(historical []FinancialData, n int) []FinancialData {
+	predictions, _ := p.fa.predictDecomposed(historical, p.req, n)
+	return predictions
+}
+
+// PredictDecomposed implements decomposer
+func (p decomposePredictor) PredictDecomposed(historical []FinancialData, n int) ([]FinancialData, *DecompositionResult) {
+	return p.fa.predictDecomposed(historical, p.req, n)
+}
+
+// decomposer is a Predictor that can also return the decomposition its
+// forecast came from, so the analysis does not have to run it twice
+type decomposer interface {
+	PredictDecomposed(historical []FinancialData, n int) ([]FinancialData, *DecompositionResult)
+}
+
+// predictDecomposition runs p, returning its decomposition when it has one
+func predictDecomposition(p Predictor, historical []FinancialData, n int) ([]FinancialData, *DecompositionResult) {
+	if d, ok := p.(decomposer); ok {
+		return d.PredictDecomposed(historical, n)
+	}
+	return p.Predict(historical, n), nil
+}
+
+// splitPredictor takes income from one model and expenses from another
+type splitPredictor struct {
+	income  Predictor
+	expense Predictor
+}
+
+// Predict implements Predictor. A month is only as confident as the less
+// confident of the two models.
+func (p splitPredictor) Predict(historical []FinancialData, n int) []FinancialData {
+	predictions, _ := p.PredictDecomposed(historical, n)
+	return predictions
+}
+
+// PredictDecomposed implements decomposer with the decomposition of
+// whichever side used the decompose model
+func (p splitPredictor) PredictDecomposed(historical []FinancialData, n int) ([]FinancialData, *DecompositionResult) {
+	predictions, incomeDecomposition := predictDecomposition(p.income, historical, n)
+	expenses, expenseDecomposition := predictDecomposition(p.expense, historical, n)
+	for i := range predictions {
+		predictions[i].Expense = expenses[i].Expense
+		predictions[i].NetFlow = math.Round((predictions[i].Income-predictions[i].Expense)*100) / 100
+		predictions[i].Confidence = math.Min(predictions[i].Confidence, expenses[i].Confidence)
+	}
+	return predictions, cmp.Or(incomeDecomposition, expenseDecomposition)
+}
+
+// seriesModels returns the models selected for income and expense; each
+// falls back to the request's Model
+func seriesModels(req AnalysisRequest) (income, expense string) {
+	income, expense = req.Model, req.Model
+	if req.IncomeModel != "" {
+		income = req.IncomeModel
+	}
+	if req.ExpenseModel != "" {
+		expense = req.ExpenseModel
+	}
+	return income, expense
+}
+
+// withModel returns req with model selected for both series
+func withModel(req AnalysisRequest, model string) AnalysisRequest {
+	req.Model = model
+	req.IncomeModel, req.ExpenseModel = "", ""
+	return req
+}
+
+// predictorFor returns the injected Predictor if there is one, otherwise the
+// built-in models selected for income and expense. The compound predictor
+// covers any mix of compound and conservative through its parameters.
+func (fa *FinancialAnalyzer) predictorFor(historical []FinancialData, req AnalysisRequest) Predictor {
+	if fa.Predictor != nil {
+		return fa.Predictor
+	}
+
+	incomeModel, expenseModel := seriesModels(req)
+	switch {
+	case incomeModel != modelDecompose && expenseModel != modelDecompose:
+		return compoundPredictor{fa: fa, params: fa.forecastParams(historical, req)}
+	case incomeModel == expenseModel:
+		return decomposePredictor{fa: fa, req: req}
+	}
+	return splitPredictor{
+		income:  fa.predictorFor(historical, withModel(req, incomeModel)),
+		expense: fa.predictorFor(historical, withModel(req, expenseModel)),
+	}
+}
+
+// PredictNext6Months generates predictions based on historical data
+func (fa *FinancialAnalyzer) PredictNext6Months(historical []FinancialData) []FinancialData {
+	return fa.predict(historical, AnalysisRequest{})
+}
+
+// predict generates predictions with the model selected for req
+func (fa *FinancialAnalyzer) predict(historical []FinancialData, req AnalysisRequest) []FinancialData {
+	predictions, _ := fa.predictModel(historical, req)
+	return predictions
+}
+
+// predictModel generates predictions with the model selected for req, with
+// the decomposition behind them when the decompose model made either series
+func (fa *FinancialAnalyzer) predictModel(historical []FinancialData, req AnalysisRequest) ([]FinancialData, *DecompositionResult) {
+	if len(historical) == 0 {
+		return make([]FinancialData, fa.horizon(req)), nil
+	}
+
+	return predictDecomposition(fa.predictorFor(historical, req), historical, fa.horizon(req))
+}
+
+// modelGrowthRates replaces the growth rates of params with those of the
+// decomposition for each series the decompose model forecast, so the
+// summary reports the growth the forecast actually used. The decompose
+// model ignores growth overrides, so they are replaced too.
+func modelGrowthRates(params forecastParams, decomposition *DecompositionResult, req AnalysisRequest) forecastParams {
+	if decomposition == nil {
+		return params
+	}
+	incomeModel, expenseModel := seriesModels(req)
+	if incomeModel == modelDecompose {
+		params.IncomeGrowthRate = trendGrowthRate(decomposition.Income)
+		params.IncomeGrowthSource = growthDecomposed
+	}
+	if expenseModel == modelDecompose {
+		params.ExpenseGrowthRate = trendGrowthRate(decomposition.Expense)
+		params.ExpenseGrowthSource = growthDecomposed
+	}
+	return params
+}
+
+// trendGrowthRate is the average monthly growth from the last fitted trend
+// value to the end of the extrapolated trend; 0 when either is not positive
+func trendGrowthRate(d SeriesDecomposition) float64 {
+	if len(d.Trend) == 0 || len(d.TrendForecast) == 0 {
+		return 0
+	}
+	last, end := d.Trend[len(d.Trend)-1], d.TrendForecast[len(d.TrendForecast)-1]
+	if last <= 0 || end <= 0 {
+		return 0
+	}
+	return math.Pow(end/last, 1/float64(len(d.TrendForecast))) - 1
+}
+
+// forecastParams derives the forecast inputs, taking the income inputs from
+// the income model and the expense growth from the expense model
+func (fa *FinancialAnalyzer) forecastParams(historical []FinancialData, req AnalysisRequest) forecastParams {
+	incomeModel, expenseModel := seriesModels(req)
+	params := fa.modelParams(historical, withModel(req, incomeModel))
+	if expenseModel != incomeModel {
+		expenseParams := fa.modelParams(historical, withModel(req, expenseModel))
+		params.ExpenseGrowthRate = expenseParams.ExpenseGrowthRate
+		params.ExpenseGrowthSource = expenseParams.ExpenseGrowthSource
+	}
+	return params
+}
+
+// modelParams derives the forecast inputs for req.Model. The conservative
+// model assumes flat revenue without seasonal uplift while keeping the
+// historical expense growth. Growth overrides in req skip the measurement
+// and are used as given, ahead of the expense floor and the model.
+func (fa *FinancialAnalyzer) modelParams(historical []FinancialData, req AnalysisRequest) forecastParams {
+	opts := growthOptionsFor(req)
+
+	// Calculate trends and seasonal patterns
+	params := forecastParams{
+		IncomeGrowthSource:   growthComputed,
+		ExpenseGrowthSource:  growthComputed,
+		MaxSeasonalFactor:    math.Inf(1),
+		SkipSeasonality:      req.SeasonallyAdjusted,
+		FiscalYearStartMonth: req.Company.FiscalYearStartMonth,
+		IncomeCeiling:        req.IncomeCeiling,
+		SeasonalStrength:     modelParam(req, req.Model, paramSeasonalStrength),
+		VolatilityAmplitude:  modelParam(req, req.Model, paramVolatilityAmplitude),
+		ProfileIncome:        req.Company.MonthlyAvgIncome,
+		ProfileExpense:       req.Company.MonthlyAvgExpense,
+	}
+
+	if req.ExpenseGrowthOverride != nil {
+		params.ExpenseGrowthRate = *req.ExpenseGrowthOverride
+		params.ExpenseGrowthSource = growthOverride
+	} else {
+		// A new fixed cost is a new baseline, not growth: measure the
+		// trend on the plateau only
+		expenseOpts := opts
+		if step := detectExpenseStep(historical); step != nil {
+			expenseOpts.SkipPeriods = max(expenseOpts.SkipPeriods, step.index)
+		}
+		params.ExpenseGrowthRate = fa.calculateGrowthRate(historical, "expense", expenseOpts)
+		if floor := fa.Config.ExpenseGrowthFloor; floor != nil && params.ExpenseGrowthRate < *floor {
+			params.ExpenseGrowthRate = *floor
+		}
+	}
+
+	if req.Model == modelConservative {
+		params.MaxSeasonalFactor = 1.0
+	}
+
+	switch {
+	case req.IncomeGrowthOverride != nil:
+		params.IncomeGrowthRate = *req.IncomeGrowthOverride
+		params.IncomeGrowthSource = growthOverride
+	case req.Model != modelConservative:
+		params.IncomeGrowthRate = fa.calculateGrowthRate(historical, "income", opts)
+	}
+
+	return params
+}
+
+// predictWithParams runs the forecast with explicit parameters
+func (fa *FinancialAnalyzer) predictWithParams(historical []FinancialData, params forecastParams, n int) []FinancialData {
+	predictions := make([]FinancialData, n)
+	for i, step := range fa.forecastSteps(historical, params, n) {
+		predictions[i] = FinancialData{
+			Month:      step.Month,
+			Income:     math.Round(step.Income*100) / 100,
+			Expense:    math.Round(step.Expense*100) / 100,
+			NetFlow:    math.Round((step.Income-step.Expense)*100) / 100,
+			Confidence: step.Confidence,
+		}
+	}
+	return predictions
+}
+
+// ForecastStep records how one predicted month of the compound forecast was
+// computed: income is baseline × income growth factor (or the logistic
+// curve) × seasonal factor × volatility factor, expense is baseline ×
+// expense growth factor × (2 − volatility factor)
+type ForecastStep struct {
+	Step  int    `json:"step"`
+	Month string `json:"month"`
+	// SeasonalMonth is the calendar month whose factor applies
+	SeasonalMonth       string  `json:"seasonal_month"`
+	SeasonalFactor      float64 `json:"seasonal_factor"`
+	IncomeGrowthFactor  float64 `json:"income_growth_factor"`
+	TrendIncome         float64 `json:"trend_income"`
+	ExpenseGrowthFactor float64 `json:"expense_growth_factor"`
+	VolatilityFactor    float64 `json:"volatility_factor"`
+	Income              float64 `json:"income"`
+	Expense             float64 `json:"expense"`
+	Confidence          float64 `json:"confidence"`
+}
+
+// ForecastTrace exposes the intermediate values of a forecast so it can be
+// verified by hand
+type ForecastTrace struct {
+	IncomeModel  string `json:"income_model"`
+	ExpenseModel string `json:"expense_model"`
+	GrowthMethod string `json:"growth_method"`
+	// TrendMonths is the number of months the trend was measured on, after
+	// history_window
+	TrendMonths      int     `json:"trend_months"`
+	BaselineMonth    string  `json:"baseline_month"`
+	BaselineIncome   float64 `json:"baseline_income"`
+	BaselineExpense  float64 `json:"baseline_expense"`
+	BaselineProrated bool    `json:"baseline_prorated"`
+	// ProfileWeight is the share of the baseline taken from the company's
+	// monthly_avg_income and monthly_avg_expense
+	ProfileWeight       float64 `json:"profile_weight,omitempty"`
+	IncomeGrowthRate    float64 `json:"income_growth_rate"`
+	IncomeGrowthSource  string  `json:"income_growth_source"`
+	ExpenseGrowthRate   float64 `json:"expense_growth_rate"`
+	ExpenseGrowthSource string  `json:"expense_growth_source"`
+	// MaxSeasonalFactor is the cap on seasonal uplift, set by the conservative model
+	MaxSeasonalFactor *float64 `json:"max_seasonal_factor,omitempty"`
+	// Steps is the month-by-month computation of the compound and
+	// conservative models; the decompose model reports its decomposition instead
+	Steps []ForecastStep `json:"steps,omitempty"`
+	// Adjustments lists, in order, what changed the steps' values into the
+	// returned predictions besides rounding
+	Adjustments []string `json:"adjustments,omitempty"`
+}
+
+// explainForecast rebuilds the intermediate values behind analysis of req.
+// The forecast is deterministic, so the trace matches what produced it.
+func (fa *FinancialAnalyzer) explainForecast(req AnalysisRequest, analysis *FinancialAnalysis) *ForecastTrace {
+	trendHistory, prorated := prorateLatest(windowHistory(req.HistoricalData, req.HistoryWindow))
+	if len(trendHistory) == 0 {
+		return nil
+	}
+
+	incomeModel, expenseModel := seriesModels(req)
+	params := fa.forecastParams(trendHistory, req)
+	baseIncome, baseExpense, weight := baseline(trendHistory, params)
+	trace := &ForecastTrace{
+		IncomeModel:         cmp.Or(incomeModel, modelCompound),
+		ExpenseModel:        cmp.Or(expenseModel, modelCompound),
+		GrowthMethod:        growthOptionsFor(withModel(req, incomeModel)).Method,
+		TrendMonths:         len(trendHistory),
+		BaselineMonth:       trendHistory[len(trendHistory)-1].Month,
+		BaselineIncome:      baseIncome,
+		BaselineExpense:     baseExpense,
+		BaselineProrated:    prorated != nil,
+		ProfileWeight:       weight,
+		IncomeGrowthRate:    params.IncomeGrowthRate,
+		IncomeGrowthSource:  params.IncomeGrowthSource,
+		ExpenseGrowthRate:   params.ExpenseGrowthRate,
+		ExpenseGrowthSource: params.ExpenseGrowthSource,
+	}
+	if !math.IsInf(params.MaxSeasonalFactor, 1) {
+		trace.MaxSeasonalFactor = &params.MaxSeasonalFactor
+	}
+	if p, ok := fa.predictorFor(trendHistory, req).(compoundPredictor); ok {
+		trace.Steps = fa.forecastSteps(trendHistory, p.params, fa.horizon(req))
+	}
+
+	if analysis.BiasCorrection != nil {
+		trace.Adjustments = append(trace.Adjustments, "bias_correction")
+	}
+	if analysis.IncomeCeiling != nil {
+		trace.Adjustments = append(trace.Adjustments, "income_ceiling")
+	}
+	if len(req.Events) > 0 {
+		trace.Adjustments = append(trace.Adjustments, "events")
+	}
+	if len(analysis.ZeroFloorMonths) > 0 {
+		trace.Adjustments = append(trace.Adjustments, "zero_floor")
+	}
+	if analysis.ExpenseFloor != nil {
+		trace.Adjustments = append(trace.Adjustments, "expense_floor")
+	}
+	if analysis.ExpenseCap != nil {
+		trace.Adjustments = append(trace.Adjustments, "expense_cap")
+	}
+	return trace
+}
+
+// seasonalFactor scales a raw seasonal factor by the seasonal strength and
+// caps it at the maximum the forecast allows; 1 when seasonality is skipped
+func (params forecastParams) seasonalFactor(raw float64) float64 {
+	if params.SkipSeasonality {
+		return 1.0
+	}
+	return math.Min(1+params.SeasonalStrength*(raw-1), params.MaxSeasonalFactor)
+}
+
+// forecastSteps computes the compound forecast month by month, unrounded
+func (fa *FinancialAnalyzer) forecastSteps(historical []FinancialData, params forecastParams, n int) []ForecastStep {
+	steps := make([]ForecastStep, n)
+	incomeGrowthRate := params.IncomeGrowthRate
+	expenseGrowthRate := params.ExpenseGrowthRate
+	forecastMonths := fa.forecastMonths(historical, n)
+
+	// Get the last known values as baseline
+	baseIncome, baseExpense, _ := baseline(historical, params)
+
+	// Add seasonal adjustment
+	seasonalFactors := fa.getSeasonalFactors(historical).Factors
+	fit := forecastFit(historical)
+
+	for i := 0; i < n; i++ {
+		monthIndex := fa.forecastMonthIndex(historical, i, params.FiscalYearStartMonth)
+		seasonalFactor := params.seasonalFactor(seasonalFactors[monthIndex])
+
+		// Apply growth rate and seasonal adjustment
+		incomeGrowthFactor := math.Pow(1+incomeGrowthRate, float64(i+1))
+		trendIncome := baseIncome * incomeGrowthFactor
+		if params.IncomeCeiling > 0 {
+			trendIncome = logisticGrowth(baseIncome, incomeGrowthRate, params.IncomeCeiling, i+1)
+		}
+		predictedIncome := trendIncome * seasonalFactor
+		expenseGrowthFactor := math.Pow(1+expenseGrowthRate, float64(i+1))
+		predictedExpense := baseExpense * expenseGrowthFactor
+
+		// Add some volatility (random factor between 0.9-1.1)
+		amplitude := params.VolatilityAmplitude
+		volatilityFactor := 1 - amplitude + (float64(i%3) * amplitude) // Simplified volatility
+		predictedIncome *= volatilityFactor
+		predictedExpense *= (2.0 - volatilityFactor) // Inverse for expenses
+
+		steps[i] = ForecastStep{
+			Step:                i + 1,
+			Month:               forecastMonths[i],
+			SeasonalMonth:       turkishMonths[monthIndex],
+			SeasonalFactor:      seasonalFactor,
+			IncomeGrowthFactor:  incomeGrowthFactor,
+			TrendIncome:         trendIncome,
+			ExpenseGrowthFactor: expenseGrowthFactor,
+			VolatilityFactor:    volatilityFactor,
+			Income:              predictedIncome,
+			Expense:             predictedExpense,
+			Confidence:          forecastConfidence(fit, len(historical), i+1),
+		}
+	}
+
+	return steps
+}
+
+// profileBlendMonths is the history length from which the company's stated
+// averages no longer count toward the baseline
+const profileBlendMonths = 12
+
+// profileWeight is the share of the baseline taken from the company's stated
+// averages: it falls linearly from 1 with no history to 0 at
+// profileBlendMonths, shifting the baseline toward the data as it grows
+func profileWeight(months int) float64 {
+	return math.Max(0, 1-float64(months)/profileBlendMonths)
+}
+
+// baseline returns the income and expense the forecast grows from: the last
+// historical month, blended with the profile averages of params by
+// profileWeight. An average of 0 is not stated and leaves its series on the
+// data. The weight is 0 when neither average applies.
+func baseline(historical []FinancialData, params forecastParams) (income, expense, weight float64) {
+	last := historical[len(historical)-1]
+	income, expense = last.Income, last.Expense
+	if params.ProfileIncome <= 0 && params.ProfileExpense <= 0 {
+		return income, expense, 0
+	}
+	weight = profileWeight(len(historical))
+	if params.ProfileIncome > 0 {
+		income = weight*params.ProfileIncome + (1-weight)*income
+	}
+	if params.ProfileExpense > 0 {
+		expense = weight*params.ProfileExpense + (1-weight)*expense
+	}
+	return income, expense, weight
+}
+
+// logisticGrowth projects base forward by months along an S-curve that grows
+// at rate while far from ceiling and flattens as it approaches it. A base at
+// or above the ceiling, or a non-positive rate, compounds as usual and is
+// capped at the ceiling.
+func logisticGrowth(base, rate, ceiling float64, months int) float64 {
+	if base <= 0 || base >= ceiling || rate <= 0 {
+		return math.Min(base*math.Pow(1+rate, float64(months)), ceiling)
+	}
+	r := math.Log(1 + rate)
+	return ceiling / (1 + (ceiling-base)/base*math.Exp(-r*float64(months)))
+}
+
+// ceilingApproach is the share of the income ceiling at which a predicted
+// month counts as approaching it
+const ceilingApproach = 0.9
+
+// CeilingReport shows how close the forecast comes to the income ceiling
+type CeilingReport struct {
+	Ceiling float64 `json:"ceiling"`
+	// PeakUtilization is the highest predicted income as a share of the ceiling
+	PeakUtilization float64 `json:"peak_utilization"`
+	// ApproachingMonth is the first month at or above 90% of the ceiling
+	ApproachingMonth string `json:"approaching_month,omitempty"`
+	// CappedMonths lists months whose seasonal peak was cut to the ceiling
+	CappedMonths []string `json:"capped_months,omitempty"`
+}
+
+// applyIncomeCeiling cuts predicted income above the ceiling, whatever model
+// produced it, and reports how close the forecast comes. Returns nil when
+// no ceiling is set.
+func applyIncomeCeiling(predictions []FinancialData, ceiling float64) *CeilingReport {
+	if ceiling <= 0 {
+		return nil
+	}
+	report := &CeilingReport{Ceiling: ceiling}
+	for i := range predictions {
+		p := &predictions[i]
+		if p.Income > ceiling {
+			p.Income = ceiling
+			p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+			report.CappedMonths = append(report.CappedMonths, p.Month)
+		}
+		utilization := p.Income / ceiling
+		report.PeakUtilization = math.Max(report.PeakUtilization, math.Round(utilization*10000)/10000)
+		if utilization >= ceilingApproach && report.ApproachingMonth == "" {
+			report.ApproachingMonth = p.Month
+		}
+	}
+	return report
+}
+
+// ExpenseCapReport shows which months the expense cap held down and by how much
+type ExpenseCapReport struct {
+	Ratio        float64  `json:"ratio"`
+	CappedMonths []string `json:"capped_months,omitempty"`
+	// ExpenseReduction is the total expense removed by the cap
+	ExpenseReduction float64 `json:"expense_reduction"`
+}
+
+// ExpenseFloorReport shows which months the expense floor held up and by how much
+type ExpenseFloorReport struct {
+	Floor         float64  `json:"floor"`
+	FlooredMonths []string `json:"floored_months"`
+	// ExpenseAddition is the total expense added by the floor
+	ExpenseAddition float64 `json:"expense_addition"`
+}
+
+// expenseFloorSlack is the share of a predicted expense's shortfall below
+// the expense floor that the forecast keeps
+const expenseFloorSlack = 0.5
+
+// applyExpenseFloor is a soft floor: each predicted expense below floor is
+// raised to keep only expenseFloorSlack of its shortfall, so a compounding
+// decline cannot undercut the fixed costs the company reports while a
+// genuine fall still shows. It runs before events, so an event's expense
+// cut is kept as given. Returns nil when no month needed it or the floor is
+// not positive.
+func applyExpenseFloor(predictions []FinancialData, floor float64) *ExpenseFloorReport {
+	if floor <= 0 {
+		return nil
+	}
+	floor = math.Round(floor*100) / 100
+	report := &ExpenseFloorReport{Floor: floor}
+	var addition float64
+	for i := range predictions {
+		p := &predictions[i]
+		if p.Expense < floor {
+			raised := math.Round((floor-(floor-p.Expense)*expenseFloorSlack)*100) / 100
+			addition += raised - p.Expense
+			p.Expense = raised
+			p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+			p.ExpenseFloored = true
+			report.FlooredMonths = append(report.FlooredMonths, p.Month)
+		}
+	}
+	if len(report.FlooredMonths) == 0 {
+		return nil
+	}
+	report.ExpenseAddition = math.Round(addition*100) / 100
+	return report
+}
+
+// applyExpenseCap cuts each predicted expense above ratio times the month's
+// predicted income. Returns nil when no ratio is set.
+func applyExpenseCap(predictions []FinancialData, ratio float64) *ExpenseCapReport {
+	if ratio <= 0 {
+		return nil
+	}
+	report := &ExpenseCapReport{Ratio: ratio}
+	var reduction float64
+	for i := range predictions {
+		p := &predictions[i]
+		limit := math.Round(math.Max(p.Income, 0)*ratio*100) / 100
+		if p.Expense > limit {
+			reduction += p.Expense - limit
+			p.Expense = limit
+			p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+			p.ExpenseCapped = true
+			report.CappedMonths = append(report.CappedMonths, p.Month)
+		}
+	}
+	report.ExpenseReduction = math.Round(reduction*100) / 100
+	return report
+}
+
+// predictDecomposed forecasts income and expense by splitting each series
+// into a linear trend, a calendar-month seasonal pattern and a residual,
+// extrapolating the trend and reapplying the seasonal pattern
+func (fa *FinancialAnalyzer) predictDecomposed(historical []FinancialData, req AnalysisRequest, n int) ([]FinancialData, *DecompositionResult) {
+	mode := req.DecompositionMode
+	if mode == "" {
+		mode = decomposeMultiplicative
+	}
+	forecastMonths := fa.forecastMonths(historical, n)
+
+	months := make([]int, len(historical))
+	for i, h := range historical {
+		months[i] = fa.getMonthIndex(h.Month)
+		if months[i] < 0 {
+			months[i] = fiscalMonthIndex(i, req.Company.FiscalYearStartMonth)
+		}
+	}
+	futureMonths := make([]int, len(forecastMonths))
+	for i, m := range forecastMonths {
+		futureMonths[i] = fa.getMonthIndex(m)
+	}
+
+	knobs := decomposeKnobs{
+		SeasonalStrength: modelParam(req, modelDecompose, paramSeasonalStrength),
+		TrendDamping:     modelParam(req, modelDecompose, paramTrendDamping),
+	}
+	income, incomeForecast := decomposeSeries(seriesValues(historical, "income"), months, futureMonths, mode, knobs)
+	expense, expenseForecast := decomposeSeries(seriesValues(historical, "expense"), months, futureMonths, mode, knobs)
+
+	fit := forecastFit(historical)
+	predictions := make([]FinancialData, len(forecastMonths))
+	for i := range predictions {
+		predictions[i] = FinancialData{
+			Month:      forecastMonths[i],
+			Income:     math.Round(incomeForecast[i]*100) / 100,
+			Expense:    math.Round(expenseForecast[i]*100) / 100,
+			NetFlow:    math.Round((incomeForecast[i]-expenseForecast[i])*100) / 100,
+			Confidence: forecastConfidence(fit, len(historical), i+1),
+		}
+	}
+
+	return predictions, &DecompositionResult{Mode: mode, Income: income, Expense: expense}
+}
+
+// forecastNetFlow forecasts the net flow series of historical on its own,
+// without going through income and expense: a least-squares trend plus
+// additive calendar-month indexes once the history is long enough for
+// seasonality, the plain trend before that. Additive because net flow
+// changes sign.
+func (fa *FinancialAnalyzer) forecastNetFlow(historical []FinancialData, req AnalysisRequest, n int) []float64 {
+	months := make([]int, len(historical))
+	for i, h := range historical {
+		months[i] = fa.getMonthIndex(h.Month)
+		if months[i] < 0 {
+			months[i] = fiscalMonthIndex(i, req.Company.FiscalYearStartMonth)
+		}
+	}
+	futureMonths := make([]int, n)
+	for i, m := range fa.forecastMonths(historical, n) {
+		futureMonths[i] = fa.getMonthIndex(m)
+	}
+
+	knobs := decomposeKnobs{TrendDamping: 1}
+	if len(historical) >= fa.Config.SeasonalMinHistory {
+		knobs.SeasonalStrength = 1
+	}
+	_, forecast := decomposeSeries(seriesValues(historical, "net_flow"), months, futureMonths, decomposeAdditive, knobs)
+	return forecast
+}
+
+// applyDirectNetFlow replaces the net flow of each prediction with the direct
+// forecast. componentNetFlows are the net flows as the model first predicted
+// them; whatever the later adjustments (events, floors, caps) changed since
+// is carried over, and the net flow bounds of the intervals move with it.
+func applyDirectNetFlow(predictions []FinancialData, componentNetFlows, direct []float64) {
+	for i := range predictions {
+		p := &predictions[i]
+		netFlow := math.Round((direct[i]+p.NetFlow-componentNetFlows[i])*100) / 100
+		shift := netFlow - p.NetFlow
+		p.NetFlow = netFlow
+		bands := []*ForecastInterval{p.Interval}
+		for j := range p.Fan {
+			bands = append(bands, &p.Fan[j].ForecastInterval)
+		}
+		for _, b := range bands {
+			if b != nil {
+				b.NetFlowLow = math.Round((b.NetFlowLow+shift)*100) / 100
+				b.NetFlowHigh = math.Round((b.NetFlowHigh+shift)*100) / 100
+			}
+		}
+	}
+}
+
+// decomposeKnobs carries the decompose model's model_params
+type decomposeKnobs struct {
+	SeasonalStrength float64
+	TrendDamping     float64
+}
+
+// decomposeSeries splits values into trend, seasonal and residual parts and
+// forecasts the calendar months in future. The trend is a least-squares line;
+// seasonal indexes average the detrended values per calendar month and are
+// normalized so they do not shift the level. Months never observed get a
+// neutral index.
+func decomposeSeries(values []float64, months, future []int, mode string, knobs decomposeKnobs) (SeriesDecomposition, []float64) {
+	n := len(values)
+	intercept, slope := linearFit(values)
+	multiplicative := mode == decomposeMultiplicative
+
+	trend := make([]float64, n)
+	var sums [12]float64
+	var counts [12]int
+	for i, v := range values {
+		trend[i] = intercept + slope*float64(i)
+		detrended := v - trend[i]
+		if multiplicative {
+			if trend[i] <= 0 {
+				continue // A ratio against a non-positive trend is meaningless
+			}
+			detrended = v / trend[i]
+		}
+		sums[months[i]] += detrended
+		counts[months[i]]++
+	}
+
+	neutral := 0.0
+	if multiplicative {
+		neutral = 1.0
+	}
+	var indexes [12]float64
+	var total float64
+	var observed int
+	for m := range indexes {
+		indexes[m] = neutral
+		if counts[m] > 0 {
+			indexes[m] = sums[m] / float64(counts[m])
+			total += indexes[m]
+			observed++
+		}
+	}
+	if observed > 0 {
+		mean := total / float64(observed)
+		for m := range indexes {
+			if counts[m] == 0 {
+				continue
+			}
+			if multiplicative && mean != 0 {
+				indexes[m] /= mean
+			} else if !multiplicative {
+				indexes[m] -= mean
+			}
+		}
+	}
+
+	d := SeriesDecomposition{
+		Trend:         make([]float64, n),
+		Seasonal:      make([]float64, n),
+		Residual:      make([]float64, n),
+		TrendForecast: make([]float64, len(future)),
+	}
+	for i, v := range values {
+		seasonal := indexes[months[i]]
+		residual := v - trend[i] - seasonal
+		if multiplicative {
+			residual = v - trend[i]*seasonal
+		}
+		d.Trend[i] = math.Round(trend[i]*100) / 100
+		d.Seasonal[i] = math.Round(seasonal*10000) / 10000
+		d.Residual[i] = math.Round(residual*100) / 100
+	}
+
+	forecast := make([]float64, len(future))
+	t, step := intercept+slope*float64(n-1), slope
+	for i, m := range future {
+		step *= knobs.TrendDamping
+		t += step
+		d.TrendForecast[i] = math.Round(t*100) / 100
+		if multiplicative {
+			forecast[i] = t * (1 + knobs.SeasonalStrength*(indexes[m]-1))
+		} else {
+			forecast[i] = t + knobs.SeasonalStrength*indexes[m]
+		}
+	}
+
+	return d, forecast
+}
+
+// Expense step detection settings. A step needs minStepBefore months on the
+// old level and minStepPlateau on the new one, a level change of at least
+// minExpenseStep, a shift of stepNoiseRatio times the month-to-month noise
+// around the two levels, and must fit at least twice as well as a straight
+// trend line, so steady growth is not mistaken for a step.
+const (
+	minStepBefore  = 2
+	minStepPlateau = 3
+	minExpenseStep = 0.15
+	stepNoiseRatio = 3.0
+)
+
+// ExpenseStep is a sustained jump of expenses to a new level
+type ExpenseStep struct {
+	// Month is the first month on the new level
+	Month       string  `json:"month"`
+	LevelBefore float64 `json:"level_before"`
+	LevelAfter  float64 `json:"level_after"`
+	Magnitude   float64 `json:"magnitude"`
+	// Change is the relative level change, e.g. 0.25 for +25%
+	Change float64 `json:"change"`
+	// index is the position of Month in the history
+	index int
+}
+
+// detectExpenseStep looks for the split of the expense series into two flat
+// levels that fits it best and returns it when it is a real step rather
+// than noise or a trend
+func detectExpenseStep(historical []FinancialData) *ExpenseStep {
+	n := len(historical)
+	if n < minStepBefore+minStepPlateau {
+		return nil
+	}
+	expenses := seriesValues(historical, "expense")
+	mean := func(values []float64) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+	sumSquares := func(values []float64, level float64) float64 {
+		var ss float64
+		for _, v := range values {
+			ss += (v - level) * (v - level)
+		}
+		return ss
+	}
+
+	best, bestSS := -1, math.Inf(1)
+	for k := minStepBefore; k <= n-minStepPlateau; k++ {
+		ss := sumSquares(expenses[:k], mean(expenses[:k])) + sumSquares(expenses[k:], mean(expenses[k:]))
+		if ss < bestSS {
+			best, bestSS = k, ss
+		}
+	}
+
+	before, after := mean(expenses[:best]), mean(expenses[best:])
+	if before <= 0 || math.Abs(after/before-1) < minExpenseStep {
+		return nil
+	}
+	noise := math.Sqrt(bestSS / float64(n-2))
+	if math.Abs(after-before) < stepNoiseRatio*noise {
+		return nil
+	}
+	intercept, slope := linearFit(expenses)
+	var trendSS float64
+	for i, v := range expenses {
+		fitted := intercept + slope*float64(i)
+		trendSS += (v - fitted) * (v - fitted)
+	}
+	if bestSS >= trendSS/2 {
+		return nil
+	}
+
+	return &ExpenseStep{
+		Month:       historical[best].Month,
+		LevelBefore: math.Round(before*100) / 100,
+		LevelAfter:  math.Round(after*100) / 100,
+		Magnitude:   math.Round((after-before)*100) / 100,
+		Change:      math.Round((after/before-1)*10000) / 10000,
+		index:       best,
+	}
+}
+
+// linearFit returns the least-squares intercept and slope of values against
+// their index
+func linearFit(values []float64) (intercept, slope float64) {
+	n := float64(len(values))
+	if n == 0 {
+		return 0, 0
+	}
+	if n == 1 {
+		return values[0], 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i, v := range values {
+		x := float64(i)
+		sumX += x
+		sumY += v
+		sumXY += x * v
+		sumXX += x * x
+	}
+	slope = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept = (sumY - slope*sumX) / n
+	return intercept, slope
+}
+
+// seriesValues extracts one field of the history as a slice
+func seriesValues(historical []FinancialData, field string) []float64 {
+	values := make([]float64, len(historical))
+	for i, h := range historical {
+		values[i] = fieldValue(h, field)
+	}
+	return values
+}
+
+// fiscalMonthIndex returns the calendar month index (0-11) of the month at
+// position in a history that starts with the fiscal year. startMonth is the
+// 1-based fiscal start month; 0 keeps the January-start calendar.
+func fiscalMonthIndex(position, startMonth int) int {
+	offset := 0
+	if startMonth > 0 {
+		offset = startMonth - 1
+	}
+	return (position + offset) % 12
+}
+
+// forecastMonthIndex returns the calendar month index (0-11) of the step-th
+// predicted month: the month after the last historical month's name, so
+// the forecast lines up with the calendar wherever the history starts.
+// Only a history whose last month is not a recognised name falls back to
+// its position from the fiscal start month.
+func (fa *FinancialAnalyzer) forecastMonthIndex(historical []FinancialData, step, startMonth int) int {
+	if len(historical) > 0 {
+		if last := fa.getMonthIndex(historical[len(historical)-1].Month); last >= 0 {
+			return (last + 1 + step) % 12
+		}
+	}
+	return fiscalMonthIndex(len(historical)+step, startMonth)
+}
+
+// minReliableConfidence is the confidence below which a predicted month is
+// no longer counted in the reliable horizon
+const minReliableConfidence = 0.5
+
+// forecastFit scores how well the history suits trend extrapolation, from 1
+// for perfectly steady income growth down towards 0 for erratic growth
+func forecastFit(historical []FinancialData) float64 {
+	volatility, ok := growthVolatility(historical)
+	if !ok || identicalNetFlows(historical) {
+		return 0.5 // Too little history or variation to judge the fit
+	}
+	return 1 / (1 + 5*volatility)
+}
+
+// identicalNetFlows reports whether every historical month has the same net
+// flow, as in mock or placeholder data. Such a history shows no volatility, so
+// a perfect fit would claim a precision the data cannot support.
+func identicalNetFlows(historical []FinancialData) bool {
+	if len(historical) < 2 {
+		return false
+	}
+	for _, h := range historical[1:] {
+		if h.NetFlow != historical[0].NetFlow {
+			return false
+		}
+	}
+	return true
+}
+
+// growthVolatility returns the standard deviation of month-over-month income
+// growth, or false when there are fewer than two growth periods
+func growthVolatility(historical []FinancialData) (float64, bool) {
+	return seriesVolatility(historical, func(d FinancialData) float64 { return d.Income })
+}
+
+// seriesVolatility returns the standard deviation of the month-over-month
+// growth of the series picked by value, or false when there are fewer than
+// two growth periods
+func seriesVolatility(historical []FinancialData, value func(FinancialData) float64) (float64, bool) {
+	var rates []float64
+	for i := 1; i < len(historical); i++ {
+		if prev := value(historical[i-1]); prev > 0 {
+			rates = append(rates, (value(historical[i])-prev)/prev)
+		}
+	}
+	if len(rates) < 2 {
+		return 0, false
+	}
+
+	var mean float64
+	for _, r := range rates {
+		mean += r
+	}
+	mean /= float64(len(rates))
+
+	var variance float64
+	for _, r := range rates {
+		variance += (r - mean) * (r - mean)
+	}
+	return math.Sqrt(variance / float64(len(rates)-1)), true
+}
+
+// Forecast interval settings. The bands are intervalLevel intervals around
+// each predicted month. Their width grows with the square root of the
+// forecast step, like a random walk, and shrinks with the square root of the
+// history length, like a standard error: at intervalReferenceHistory months
+// the band is z·σ·√step, four times as much history halves it.
+const (
+	intervalLevel            = 0.8
+	intervalReferenceHistory = 12
+	// defaultIntervalVolatility is the monthly growth volatility assumed
+	// when the history is too short or too uniform to measure one
+	defaultIntervalVolatility = 0.1
+)
+
+// ForecastInterval is the range a predicted month is expected to fall in
+type ForecastInterval struct {
+	IncomeLow   float64 `json:"income_low"`
+	IncomeHigh  float64 `json:"income_high"`
+	ExpenseLow  float64 `json:"expense_low"`
+	ExpenseHigh float64 `json:"expense_high"`
+	NetFlowLow  float64 `json:"net_flow_low"`
+	NetFlowHigh float64 `json:"net_flow_high"`
+}
+
+// FanBand is the forecast interval at one confidence level of a fan chart
+type FanBand struct {
+	Level float64 `json:"level"`
+	ForecastInterval
+}
+
+// maxFanLevels caps the number of fan chart bands per predicted month
+const maxFanLevels = 10
+
+// validateFanLevels checks the requested fan chart confidence levels
+func validateFanLevels(levels []float64) error {
+	if len(levels) > maxFanLevels {
+		return fmt.Errorf("at most %d fan levels are allowed", maxFanLevels)
+	}
+	for _, level := range levels {
+		if !(level > 0 && level < 1) {
+			return fmt.Errorf("fan level %g must be between 0 and 1", level)
+		}
+	}
+	return nil
+}
+
+// addIntervals sets the forecast interval of each prediction, and a fan band
+// per level, from the income and expense volatility of historical. All bands
+// share that volatility and differ only in the normal quantile of their
+// level, so wider levels always contain narrower ones. A history with
+// identical months has no measurable volatility, so it gets the default
+// rather than a zero-width band.
+func addIntervals(predictions []FinancialData, historical []FinancialData, fanLevels []float64) {
+	if len(historical) == 0 {
+		return
+	}
+	incomeVolatility, expenseVolatility, historyScale := forecastVolatility(historical)
+	levels := slices.Compact(slices.Sorted(slices.Values(fanLevels)))
+
+	for i := range predictions {
+		p := &predictions[i]
+		band := func(level float64) ForecastInterval {
+			spread := math.Sqrt2 * math.Erfinv(level) * math.Sqrt(float64(i+1)) * historyScale
+			incomeHalf := math.Abs(p.Income) * incomeVolatility * spread
+			expenseHalf := math.Abs(p.Expense) * expenseVolatility * spread
+			interval := ForecastInterval{
+				IncomeLow:   math.Round(math.Max(p.Income-incomeHalf, 0)*100) / 100,
+				IncomeHigh:  math.Round((p.Income+incomeHalf)*100) / 100,
+				ExpenseLow:  math.Round(math.Max(p.Expense-expenseHalf, 0)*100) / 100,
+				ExpenseHigh: math.Round((p.Expense+expenseHalf)*100) / 100,
+			}
+			interval.NetFlowLow = math.Round((interval.IncomeLow-interval.ExpenseHigh)*100) / 100
+			interval.NetFlowHigh = math.Round((interval.IncomeHigh-interval.ExpenseLow)*100) / 100
+			return interval
+		}
+
+		interval := band(intervalLevel)
+		p.Interval = &interval
+		for _, level := range levels {
+			p.Fan = append(p.Fan, FanBand{Level: level, ForecastInterval: band(level)})
+		}
+	}
+}
+
+// forecastVolatility returns the monthly income and expense volatility of
+// historical, falling back to defaultIntervalVolatility when it cannot be
+// measured, and the factor that scales it for the history length
+func forecastVolatility(historical []FinancialData) (income, expense, historyScale float64) {
+	volatility := func(value func(FinancialData) float64) float64 {
+		v, ok := seriesVolatility(historical, value)
+		if !ok || identicalNetFlows(historical) {
+			return defaultIntervalVolatility
+		}
+		return v
+	}
+	income = volatility(func(d FinancialData) float64 { return d.Income })
+	expense = volatility(func(d FinancialData) float64 { return d.Expense })
+	historyScale = math.Sqrt(intervalReferenceHistory / float64(len(historical)))
+	return income, expense, historyScale
+}
+
+// Monte Carlo settings: the break-even estimate runs at most maxSimulations
+// paths, drawn from a fixed seed so an unchanged request gets the same result
+const (
+	maxSimulations = 10000
+	simulationSeed = 20240101
+)
+
+// BreakEven is the Monte Carlo estimate of the company staying cash-positive
+// over the forecast
+type BreakEven struct {
+	Paths int `json:"paths"`
+	// StartingBalance is the opening balance (0 when omitted) plus the
+	// historical net flow, where balance_projection reaches the forecast
+	StartingBalance float64 `json:"starting_balance"`
+	// Probability is the share of paths whose cumulative balance never goes
+	// negative in any forecast month
+	Probability float64 `json:"probability"`
+	// ExpectedShortfall is the average deepest deficit of the paths that do
+	// go negative; 0 when none does
+	ExpectedShortfall float64 `json:"expected_shortfall"`
+}
+
+// simulateBreakEven draws paths around predictions with the volatility of
+// the forecast intervals: each series follows a random walk of normal monthly
+// shocks, so the spread of a month's simulated values matches its interval.
+// trendHistory is the history the forecast learned from, so the volatility
+// matches the intervals, and every path starts from start. A capital
+// injection is added to every path in its month. Returns nil when paths is 0.
+func simulateBreakEven(predictions, trendHistory []FinancialData, start float64, injection *CapitalInjection, paths int) *BreakEven {
+	if paths <= 0 || len(predictions) == 0 || len(trendHistory) == 0 {
+		return nil
+	}
+	incomeVolatility, expenseVolatility, historyScale := forecastVolatility(trendHistory)
+
+	rng := mathrand.New(mathrand.NewPCG(simulationSeed, uint64(len(predictions))))
+	var positive int
+	var shortfall float64
+	for range paths {
+		balance, trough := start, 0.0
+		var incomeWalk, expenseWalk float64
+		for _, p := range predictions {
+			incomeWalk += rng.NormFloat64()
+			expenseWalk += rng.NormFloat64()
+			incomeShock := math.Abs(p.Income) * incomeVolatility * historyScale * incomeWalk
+			expenseShock := math.Abs(p.Expense) * expenseVolatility * historyScale * expenseWalk
+			balance += p.NetFlow + incomeShock - expenseShock
+			if injection != nil && p.Month == injection.Month {
+				balance += injection.Amount
+			}
+			trough = math.Min(trough, balance)
+		}
+		if trough < 0 {
+			shortfall -= trough
+		} else {
+			positive++
+		}
+	}
+
+	result := &BreakEven{
+		Paths:           paths,
+		StartingBalance: math.Round(start*100) / 100,
+		Probability:     math.Round(float64(positive)/float64(paths)*10000) / 10000,
+	}
+	if negative := paths - positive; negative > 0 {
+		result.ExpectedShortfall = math.Round(shortfall/float64(negative)*100) / 100
+	}
+	return result
+}
+
+// historicalBalance is the balance at the end of historical: the opening
+// balance, 0 when omitted, plus the historical net flow
+func historicalBalance(opening *float64, historical []FinancialData) float64 {
+	var balance float64
+	if opening != nil {
+		balance = *opening
+	}
+	for _, h := range historical {
+		balance += h.NetFlow
+	}
+	return balance
+}
+
+// forecastConfidence decays the fit exponentially with the distance of the
+// predicted month. Longer histories decay more slowly, so their forecasts
+// stay trustworthy further out.
+func forecastConfidence(fit float64, historyLen, step int) float64 {
+	decayMonths := 2 + float64(historyLen)/2
+	confidence := fit * math.Exp(-float64(step)/decayMonths)
+	return math.Round(confidence*100) / 100
+}
+
+// reliableHorizon counts the leading predicted months whose confidence is
+// at least minReliableConfidence
+func reliableHorizon(predictions []FinancialData) int {
+	for i, p := range predictions {
+		if p.Confidence < minReliableConfidence {
+			return i
+		}
+	}
+	return len(predictions)
+}
+
+// forecastMonths returns the names of the n months the forecast covers, the
+// months following the last month of historical
+func (fa *FinancialAnalyzer) forecastMonths(historical []FinancialData, n int) []string {
+	months := make([]string, n)
+	last := fa.lastHistoricalMonth(historical)
+	for i := range months {
+		months[i] = fa.getMonthName(last.AddDate(0, i+1, 0))
+	}
+	return months
+}
+
+// applyBiasCorrection scales the predicted income and expense by the
+// company's bias factors; a nil correction leaves predictions unchanged
+func applyBiasCorrection(predictions []FinancialData, bias *BiasCorrection) {
+	if bias == nil {
+		return
+	}
+	for i := range predictions {
+		p := &predictions[i]
+		p.Income = math.Round(p.Income*bias.IncomeFactor*100) / 100
+		p.Expense = math.Round(p.Expense*bias.ExpenseFactor*100) / 100
+		p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+	}
+}
+
+// addDeltas fills in each prediction's change from last, the latest actual
+// month, and from the previous month
+func addDeltas(predictions []FinancialData, last FinancialData) {
+	previous := last
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	for i := range predictions {
+		p := &predictions[i]
+		p.Deltas = &ForecastDeltas{
+			IncomeDelta:   round(p.Income - last.Income),
+			ExpenseDelta:  round(p.Expense - last.Expense),
+			NetFlowDelta:  round(p.NetFlow - last.NetFlow),
+			IncomeChange:  round(p.Income - previous.Income),
+			ExpenseChange: round(p.Expense - previous.Expense),
+			NetFlowChange: round(p.NetFlow - previous.NetFlow),
+		}
+		previous = *p
+	}
+}
+
+// applyEvents adds the deltas of known future events to the matching
+// predicted months and marks them as event-adjusted
+func applyEvents(predictions []FinancialData, events []ForecastEvent) {
+	for _, e := range events {
+		for i := range predictions {
+			if predictions[i].Month != e.Month {
+				continue
+			}
+			p := &predictions[i]
+			p.Income = math.Round((p.Income+e.IncomeDelta)*100) / 100
+			p.Expense = math.Round((p.Expense+e.ExpenseDelta)*100) / 100
+			p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+			p.EventAdjusted = true
+			break
+		}
+	}
+}
+
+// applyZeroFloor raises negative predicted income and expense to zero, as a
+// declining trend or a large negative event can carry them below it, and
+// returns the months it changed
+func applyZeroFloor(predictions []FinancialData) []string {
+	var floored []string
+	for i := range predictions {
+		p := &predictions[i]
+		if p.Income >= 0 && p.Expense >= 0 {
+			continue
+		}
+		p.Income = math.Max(p.Income, 0)
+		p.Expense = math.Max(p.Expense, 0)
+		p.NetFlow = math.Round((p.Income-p.Expense)*100) / 100
+		p.ZeroFloored = true
+		floored = append(floored, p.Month)
+	}
+	return floored
+}
+
+// calculateGrowthRate calculates monthly growth rate. The arithmetic method
+// averages the month-over-month rates; the geometric method derives the
+// compound rate from the first and last values. A drop to zero income counts
+// as a -100% period unless opts excludes zero-income months.
+func (fa *FinancialAnalyzer) calculateGrowthRate(data []FinancialData, field string, opts growthOptions) float64 {
+	data = data[min(opts.SkipPeriods, len(data)):]
+	if field == "income" && opts.ExcludeZeroIncome {
+		data = slices.DeleteFunc(slices.Clone(data), func(d FinancialData) bool {
+			return d.Income == 0
+		})
+	}
+
+	if len(data) < 2 {
+		return fa.Config.DefaultGrowthRate
+	}
+
+	if opts.Method == growthGeometric {
+		first := fieldValue(data[0], field)
+		last := fieldValue(data[len(data)-1], field)
+		// Fall back to the arithmetic mean when either end is zero or negative
+		if first > 0 && last > 0 {
+			return clampGrowthRate(math.Pow(last/first, 1/float64(len(data)-1)) - 1)
+		}
+	}
+
+	var totalGrowth float64
+	var validPeriods int
+
+	for i := 1; i < len(data); i++ {
+		current := fieldValue(data[i], field)
+		previous := fieldValue(data[i-1], field)
+
+		if previous > 0 {
+			growth := (current - previous) / previous
+			totalGrowth += growth
+			validPeriods++
+		}
+	}
+
+	if validPeriods == 0 {
+		return fa.Config.DefaultGrowthRate
+	}
+
+	return clampGrowthRate(totalGrowth / float64(validPeriods))
+}
+
+// clampGrowthRate caps growth rate between -20% and +30% monthly
+func clampGrowthRate(rate float64) float64 {
+	if rate > 0.30 {
+		return 0.30
+	} else if rate < -0.20 {
+		return -0.20
+	}
+	return rate
+}
+
+// fieldValue returns the income, expense or net flow of d
+func fieldValue(d FinancialData, field string) float64 {
+	switch field {
+	case "income":
+		return d.Income
+	case "net_flow":
+		return d.NetFlow
+	}
+	return d.Expense
+}
+
+// sensitivityDeltas are the growth-rate perturbations applied in the sensitivity report
+var sensitivityDeltas = []float64{-0.02, -0.01, 0, 0.01, 0.02}
+
+// analyzeSensitivity re-runs the forecast with the income growth rate shifted by
+// each of sensitivityDeltas and reports the spread of predicted total net flow.
+// Expense growth is kept as computed so the report isolates the revenue assumption.
+// params carries the growth rates the forecast reported; when the decompose
+// model forecast income, its modelOutput is shifted instead of re-running
+// the compound forecast.
+func (fa *FinancialAnalyzer) analyzeSensitivity(historical []FinancialData, req AnalysisRequest, params forecastParams, modelOutput []FinancialData) SensitivityReport {
+	report := SensitivityReport{}
+	if len(historical) == 0 {
+		return report
+	}
+
+	incomeGrowthRate := params.IncomeGrowthRate
+	report.BaseIncomeGrowthRate = math.Round(incomeGrowthRate*10000) / 10000
+
+	minNetFlow, maxNetFlow := math.Inf(1), math.Inf(-1)
+	for _, delta := range sensitivityDeltas {
+		var netFlow float64
+		var predicted []FinancialData
+		if params.IncomeGrowthSource == growthDecomposed {
+			predicted = shiftIncomeGrowth(modelOutput, incomeGrowthRate, delta)
+		} else {
+			perturbed := params
+			perturbed.IncomeGrowthRate = incomeGrowthRate + delta
+			predicted = fa.predictWithParams(historical, perturbed, fa.horizon(req))
+		}
+		for _, p := range predicted {
+			netFlow += p.NetFlow
+		}
+
+		minNetFlow = math.Min(minNetFlow, netFlow)
+		maxNetFlow = math.Max(maxNetFlow, netFlow)
+
+		report.Scenarios = append(report.Scenarios, SensitivityScenario{
+			GrowthDelta:           delta,
+			IncomeGrowthRate:      math.Round((incomeGrowthRate+delta)*10000) / 10000,
+			PredictedTotalNetFlow: math.Round(netFlow*100) / 100,
+		})
+	}
+
+	report.MinPredictedNetFlow = math.Round(minNetFlow*100) / 100
+	report.MaxPredictedNetFlow = math.Round(maxNetFlow*100) / 100
+	report.PredictedNetFlowRange = math.Round((maxNetFlow-minNetFlow)*100) / 100
+
+	return report
+}
+
+// shiftIncomeGrowth returns predictions with the monthly income growth rate
+// moved from rate to rate+delta, compounding from the first predicted month
+func shiftIncomeGrowth(predictions []FinancialData, rate, delta float64) []FinancialData {
+	shifted := slices.Clone(predictions)
+	if 1+rate <= 0 {
+		return shifted
+	}
+	step := (1 + rate + delta) / (1 + rate)
+	for i := range shifted {
+		p := &shifted[i]
+		p.Income = p.Income * math.Pow(step, float64(i+1))
+		p.NetFlow = p.Income - p.Expense
+	}
+	return shifted
+}
+
+// seasonalFactors is the outcome of getSeasonalFactors
+type seasonalFactors struct {
+	// Factors holds one multiplier per calendar month, January first
+	Factors []float64
+	// Computed is true when the factors come from the data rather than the defaults
+	Computed bool
+	// ClampedMonths lists the months whose computed factor was clamped
+	ClampedMonths []string
+	// MonthSources says per calendar month whether its factor was computed,
+	// set to neutral for too few samples, or taken from the defaults
+	MonthSources []string
+}
+
+// Per-month seasonal factor sources
+const (
+	factorComputed = "computed"
+	factorNeutral  = "neutral"
+	factorDefault  = "default"
+)
+
+// AdjustedMonth is a historical month with seasonality removed. Only income
+// is seasonal in the forecast, so expense is carried over unchanged.
+type AdjustedMonth struct {
+	Month          string  `json:"month"`
+	SeasonalFactor float64 `json:"seasonal_factor"`
+	Income         float64 `json:"income"`
+	Expense        float64 `json:"expense"`
+	NetFlow        float64 `json:"net_flow"`
+}
+
+// seasonallyAdjust divides each month's income of historical by the seasonal
+// factor the compound forecast applies for its calendar month, scaled by the
+// income model's seasonal strength and cap. Input marked as already
+// seasonally adjusted gets a factor of 1.
+func (fa *FinancialAnalyzer) seasonallyAdjust(historical []FinancialData, req AnalysisRequest) []AdjustedMonth {
+	factors := fa.getSeasonalFactors(historical).Factors
+	params := fa.forecastParams(historical, req)
+	adjusted := make([]AdjustedMonth, len(historical))
+	for i, h := range historical {
+		month := fa.getMonthIndex(h.Month)
+		if month < 0 {
+			month = fiscalMonthIndex(i, req.Company.FiscalYearStartMonth)
+		}
+		factor := params.seasonalFactor(factors[month])
+		// A zero factor, possible with seasonal_factor_min 0, cannot divide
+		if factor <= 0 {
+			factor = 1.0
+		}
+		income := h.Income / factor
+		adjusted[i] = AdjustedMonth{
+			Month:          h.Month,
+			SeasonalFactor: math.Round(factor*10000) / 10000,
+			Income:         math.Round(income*100) / 100,
+			Expense:        h.Expense,
+			NetFlow:        math.Round((income-h.Expense)*100) / 100,
+		}
+	}
+	return adjusted
+}
+
+// getSeasonalFactors returns seasonal adjustment factors. They are computed
+// from the data once it spans seasonal_min_history months; a calendar month
+// with fewer than seasonal_min_samples observations is then neutral (1.0)
+// rather than trusted. Computed factors are clamped to the configured range
+// so a single outlier month cannot blow up the forecast.
+func (fa *FinancialAnalyzer) getSeasonalFactors(data []FinancialData) seasonalFactors {
+	// Default seasonal factors (can be calculated from historical data)
+	factors := []float64{
+		1.0, 0.95, 1.05, 1.1, 1.15, 1.2, // Jan-Jun
+		1.25, 1.2, 1.1, 1.05, 1.0, 1.3, // Jul-Dec (Dec higher for year-end)
+	}
+	result := seasonalFactors{Factors: factors, MonthSources: make([]string, 12)}
+	for i := range result.MonthSources {
+		result.MonthSources[i] = factorDefault
+	}
+
+	if len(data) >= fa.Config.SeasonalMinHistory {
+		// Calculate seasonal patterns from historical data
+		monthlyAvgs := make([]float64, 12)
+		monthlyCounts := make([]int, 12)
+
+		for _, d := range data {
+			month := fa.getMonthIndex(d.Month)
+			if month >= 0 && month < 12 {
+				monthlyAvgs[month] += d.Income
+				monthlyCounts[month]++
+			}
+		}
+
+		totalAvg := 0.0
+		validMonths := 0
+		minSamples := max(fa.Config.SeasonalMinSamples, 1)
+
+		for i := 0; i < 12; i++ {
+			if monthlyCounts[i] >= minSamples {
+				monthlyAvgs[i] /= float64(monthlyCounts[i])
+				totalAvg += monthlyAvgs[i]
+				validMonths++
+			}
+		}
+
+		// Without any sampled income there is no pattern to scale by, so
+		// the default factors stay in place
+		if validMonths > 0 && totalAvg > 0 {
+			totalAvg /= float64(validMonths)
+
+			for i := 0; i < 12; i++ {
+				if monthlyCounts[i] < minSamples {
+					factors[i] = 1.0
+					result.MonthSources[i] = factorNeutral
+					continue
+				}
+				factor := monthlyAvgs[i] / totalAvg
+				clamped := math.Max(fa.Config.SeasonalFactorMin, math.Min(factor, fa.Config.SeasonalFactorMax))
+				if clamped != factor {
+					result.ClampedMonths = append(result.ClampedMonths, turkishMonths[i])
+				}
+				factors[i] = clamped
+				result.MonthSources[i] = factorComputed
+			}
+			result.Factors = smoothFactors(factors, fa.Config.SeasonalSmoothingWindow)
+			result.Computed = true
+		}
+	}
+
+	return result
+}
+
+// smoothFactors replaces each factor with the mean of the window factors
+// centred on it, wrapping from December to January. Even windows are widened
+// by one to stay centred and windows wider than 11 act as 11, the widest that
+// counts no month twice. A circular moving average keeps the mean unchanged.
+func smoothFactors(factors []float64, window int) []float64 {
+	if window <= 1 {
+		return factors
+	}
+	n := len(factors)
+	half := min(window/2, (n-1)/2)
+
+	smoothed := make([]float64, n)
+	for i := range factors {
+		var sum float64
+		for offset := -half; offset <= half; offset++ {
+			sum += factors[((i+offset)%n+n)%n]
+		}
+		smoothed[i] = sum / float64(2*half+1)
+	}
+	return smoothed
+}
+
+// seasonalProfile averages value per calendar month and divides by the mean
+// of those averages, giving unclamped seasonal factors. It returns nil unless
+// every calendar month is present and the series averages above zero.
+func (fa *FinancialAnalyzer) seasonalProfile(data []FinancialData, value func(FinancialData) float64) []float64 {
+	sums := make([]float64, 12)
+	counts := make([]int, 12)
+	for _, d := range data {
+		if month := fa.getMonthIndex(d.Month); month >= 0 {
+			sums[month] += value(d)
+			counts[month]++
+		}
+	}
+
+	var mean float64
+	for i := range sums {
+		if counts[i] == 0 {
+			return nil
+		}
+		sums[i] /= float64(counts[i])
+		mean += sums[i] / 12
+	}
+	if mean <= 0 {
+		return nil
+	}
+	for i := range sums {
+		sums[i] /= mean
+	}
+	return sums
+}
+
+// Seasonal phase thresholds: both profiles must swing at least
+// minSeasonalSwing between their highest and lowest month, and the expense
+// cycle must be shifted by at least minPhaseOffset months, to raise a
+// timing risk
+const (
+	minSeasonalSwing = 0.1
+	minPhaseOffset   = 1
+)
+
+// seasonalPhase finds the shift of the expense cycle against the income
+// cycle as the lag with the highest circular cross-correlation of their
+// seasonal profiles. Returns nil when the history has not enough data for
+// seasonal factors or does not cover every calendar month.
+func (fa *FinancialAnalyzer) seasonalPhase(data []FinancialData) *SeasonalPhase {
+	if len(data) < fa.Config.SeasonalMinHistory {
+		return nil
+	}
+	income := fa.seasonalProfile(data, func(d FinancialData) float64 { return d.Income })
+	expense := fa.seasonalProfile(data, func(d FinancialData) float64 { return d.Expense })
+	if income == nil || expense == nil {
+		return nil
+	}
+
+	bestLag, bestCorr := 0, math.Inf(-1)
+	for lag := range 12 {
+		var corr float64
+		for i := range 12 {
+			corr += (income[i] - 1) * (expense[(i+lag)%12] - 1)
+		}
+		// Prefer the smaller shift when correlations tie
+		if corr > bestCorr+1e-9 {
+			bestLag, bestCorr = lag, corr
+		}
+	}
+	if bestLag > 6 {
+		bestLag -= 12
+	}
+
+	phase := &SeasonalPhase{
+		IncomePeakMonth:   turkishMonths[slices.Index(income, slices.Max(income))],
+		ExpensePeakMonth:  turkishMonths[slices.Index(expense, slices.Max(expense))],
+		PhaseOffsetMonths: bestLag,
+	}
+	swing := func(f []float64) float64 { return slices.Max(f) - slices.Min(f) }
+	if math.Abs(float64(bestLag)) >= minPhaseOffset && swing(income) >= minSeasonalSwing && swing(expense) >= minSeasonalSwing {
+		for i := range 12 {
+			if expense[i] > 1 && income[i] < 1 {
+				phase.RiskMonths = append(phase.RiskMonths, turkishMonths[i])
+			}
+		}
+		phase.TimingRisk = len(phase.RiskMonths) > 0
+	}
+	return phase
+}
+
+// SeasonalityInfo exposes the seasonal factors (January to December) that drive the forecast
+type SeasonalityInfo struct {
+	Factors []float64 `json:"factors"`
+	// Source is "computed" when derived from the history, "default" otherwise
+	Source string `json:"source"`
+	// ClampedMonths lists months whose computed factor hit the configured range
+	ClampedMonths []string `json:"clamped_months,omitempty"`
+	// MonthSources is computed, neutral or default for each month, January first
+	MonthSources []string `json:"month_sources,omitempty"`
+	// Applied is false when the input was already seasonally adjusted
+	Applied bool `json:"applied"`
+}
+
+// unappliedSeasonality reports neutral factors for seasonally adjusted input
+func unappliedSeasonality() SeasonalityInfo {
+	factors := make([]float64, 12)
+	for i := range factors {
+		factors[i] = 1.0
+	}
+	return SeasonalityInfo{Factors: factors, Source: "none", Applied: false}
+}
+
+// analyzeSeasonality reports the seasonal factors getSeasonalFactors produces for data
+func (fa *FinancialAnalyzer) analyzeSeasonality(data []FinancialData) SeasonalityInfo {
+	seasonal := fa.getSeasonalFactors(data)
+
+	info := SeasonalityInfo{
+		Factors:       make([]float64, len(seasonal.Factors)),
+		Source:        "default",
+		ClampedMonths: seasonal.ClampedMonths,
+		MonthSources:  seasonal.MonthSources,
+		Applied:       true,
+	}
+	if seasonal.Computed {
+		info.Source = "computed"
+	}
+	for i, f := range seasonal.Factors {
+		info.Factors[i] = math.Round(f*10000) / 10000
+	}
+	return info
+}
+
+// turkishMonths are the month names used throughout the API, January first
+var turkishMonths = []string{
+	"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+	"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık",
+}
+
+// getMonthIndex returns month index (0-11). Matching ignores case and
+// Turkish diacritics, so "şubat" and "Subat" both resolve to Şubat.
+func (fa *FinancialAnalyzer) getMonthIndex(monthName string) int {
+	key := normalizeMonthName(monthName)
+	for i, month := range turkishMonths {
+		if normalizeMonthName(month) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// monthFolder strips the Turkish diacritics after case folding
+var monthFolder = strings.NewReplacer("ç", "c", "ğ", "g", "ı", "i", "ö", "o", "ş", "s", "ü", "u")
+
+// normalizeMonthName case-folds name with Turkish rules (İ→i, I→ı) and then
+// removes diacritics, e.g. "ŞUBAT", "şubat" and "Subat" all become "subat"
+func normalizeMonthName(name string) string {
+	return monthFolder.Replace(strings.ToLowerSpecial(unicode.TurkishCase, strings.TrimSpace(name)))
+}
+
+// canonicalMonth returns the Turkish spelling of a recognized month name and
+// name itself otherwise, so month names can be matched as plain strings
+func (fa *FinancialAnalyzer) canonicalMonth(name string) string {
+	if i := fa.getMonthIndex(name); i >= 0 {
+		return turkishMonths[i]
+	}
+	return name
+}
+
+// getMonthName returns Turkish month name
+func (fa *FinancialAnalyzer) getMonthName(t time.Time) string {
+	return turkishMonths[t.Month()-1]
+}
+
+// Errors returned, wrapped with context, by the analyzer's exported
+// functions; callers match them with errors.Is
+var (
+	ErrInsufficientData  = errors.New("insufficient historical data")
+	ErrInvalidMonth      = errors.New("invalid month")
+	ErrNonFinite         = errors.New("non-finite value")
+	ErrPartialMonth      = errors.New("invalid partial month")
+	ErrInvalidModelParam = errors.New("invalid model parameter")
+	ErrCurrencyMismatch  = errors.New("currency mismatch")
+	ErrStringTooLong     = errors.New("string too long")
+)
+
+// FieldError ties a validation error to the request field it was found in
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Error implements error
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, usually wrapping a sentinel
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks req before it is analyzed: a non-empty history, finite
+// values, a reachable forecast_until, and event, budget and partial months
+// that fit the forecast. The
+// error wraps ErrInsufficientData, ErrNonFinite, ErrInvalidMonth or
+// ErrPartialMonth in a *FieldError.
+func (fa *FinancialAnalyzer) Validate(req AnalysisRequest) error {
+	if len(req.HistoricalData) == 0 {
+		return &FieldError{Field: "historical_data", Err: ErrInsufficientData}
+	}
+	if err := finiteRequest(req); err != nil {
+		return err
+	}
+	if err := fa.validateStringLengths(req.Company); err != nil {
+		return err
+	}
+	horizon, err := fa.forecastUntilMonths(req.HistoricalData, req.ForecastUntil)
+	if err != nil {
+		return &FieldError{Field: "forecast_until", Err: err}
+	}
+	forecastMonths := fa.forecastMonths(req.HistoricalData, horizon)
+	if err := fa.validateEvents(req.Events, forecastMonths); err != nil {
+		return &FieldError{Field: "events", Err: err}
+	}
+	if err := fa.validateBudget(req.Budget, forecastMonths); err != nil {
+		return &FieldError{Field: "budget", Err: err}
+	}
+	if err := fa.validateInjection(req.CapitalInjection, forecastMonths); err != nil {
+		return &FieldError{Field: "capital_injection", Err: err}
+	}
+	if err := validateProration(req.HistoricalData); err != nil {
+		return &FieldError{Field: "historical_data", Err: fmt.Errorf("%w: %w", ErrPartialMonth, err)}
+	}
+	if err := validateFanLevels(req.FanLevels); err != nil {
+		return &FieldError{Field: "fan_levels", Err: err}
+	}
+	if req.Simulations < 0 || req.Simulations > maxSimulations {
+		return &FieldError{Field: "simulations", Err: fmt.Errorf("%d simulations requested; between 0 and %d are allowed", req.Simulations, maxSimulations)}
+	}
+	if err := validateModelParams(req); err != nil {
+		return err
+	}
+	if fa.Config.CurrencyMismatch == currencyMismatchError {
+		// Only the months the analysis uses count, as in the warning
+		historical := windowHistory(req.HistoricalData, req.HistoryWindow)
+		if reference, mismatched := currencyMismatches(req.Company, historical); len(mismatched) > 0 {
+			i := len(req.HistoricalData) - len(historical) + mismatched[0]
+			return &FieldError{
+				Field: fmt.Sprintf("historical_data[%d].currency", i),
+				Err:   fmt.Errorf("%w: %s is in %s, expected %s", ErrCurrencyMismatch, req.HistoricalData[i].Month, normalizeCurrency(req.HistoricalData[i].Currency), reference),
+			}
+		}
+	}
+	return nil
+}
+
+// validateStringLengths checks the company's free-text fields against
+// MaxStringLength, counting characters rather than bytes
+func (fa *FinancialAnalyzer) validateStringLengths(company CompanyProfile) error {
+	limit := fa.Config.MaxStringLength
+	if limit <= 0 {
+		return nil
+	}
+	for _, f := range []struct{ field, value string }{
+		{"company.id", company.ID},
+		{"company.name", company.Name},
+		{"company.sector", company.Sector},
+		{"company.currency", company.Currency},
+	} {
+		if n := utf8.RuneCountInString(f.value); n > limit {
+			return &FieldError{Field: f.field, Err: fmt.Errorf("%w: %d characters, at most %d allowed", ErrStringTooLong, n, limit)}
+		}
+	}
+	return nil
+}
+
+// stripControlCharacters removes control characters such as newlines and
+// escape sequences from the company's free-text fields, which are logged and
+// echoed back, so they cannot forge log lines or terminal output
+func stripControlCharacters(company *CompanyProfile) {
+	strip := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	company.ID = strip(company.ID)
+	company.Name = strip(company.Name)
+	company.Sector = strip(company.Sector)
+	company.Currency = strip(company.Currency)
+}
+
+// Values of AnalyzerConfig.CurrencyMismatch
+const (
+	currencyMismatchWarn  = "warn"
+	currencyMismatchError = "error"
+)
+
+// maxHorizonLimit is the longest forecast whose month names are unique.
+// Predicted months are matched by name (events, budgets, capital injections,
+// actuals), so a thirteenth month would be mistaken for the first.
+const maxHorizonLimit = 12
+
+// validateConfig checks the settings of a config that JSON decoding alone
+// cannot: the recommendation rules, the currency_mismatch policy, which
+// would otherwise quietly fall back to warning on a typo, and max_horizon
+func validateConfig(cfg AnalyzerConfig) error {
+	if cfg.MaxHorizon < 1 || cfg.MaxHorizon > maxHorizonLimit {
+		return fmt.Errorf("max_horizon %d must be between 1 and %d", cfg.MaxHorizon, maxHorizonLimit)
+	}
+	if err := validateRecommendationRules(cfg.RecommendationRules); err != nil {
+		return err
+	}
+	switch cfg.CurrencyMismatch {
+	case "", currencyMismatchWarn, currencyMismatchError:
+	default:
+		return fmt.Errorf("currency_mismatch %q must be %q or %q", cfg.CurrencyMismatch, currencyMismatchWarn, currencyMismatchError)
+	}
+	return nil
+}
+
+// normalizeCurrency upper-cases and trims a currency code
+func normalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// currencyMismatches returns the currency the amounts are expected in, the
+// company's or else the first month that names one, and the indexes of the
+// historical months that name another. Months without a currency inherit it.
+func currencyMismatches(company CompanyProfile, historical []FinancialData) (string, []int) {
+	reference := normalizeCurrency(company.Currency)
+	var mismatched []int
+	for i, h := range historical {
+		code := normalizeCurrency(h.Currency)
+		switch {
+		case code == "":
+		case reference == "":
+			reference = code
+		case code != reference:
+			mismatched = append(mismatched, i)
+		}
+	}
+	return reference, mismatched
+}
+
+// finiteRequest reports the first NaN or infinite amount in req. JSON cannot
+// carry them, but library callers can.
+func finiteRequest(req AnalysisRequest) error {
+	check := func(field string, v float64) error {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &FieldError{Field: field, Err: ErrNonFinite}
+		}
+		return nil
+	}
+	for i, d := range req.HistoricalData {
+		for _, err := range []error{
+			check(fmt.Sprintf("historical_data[%d].income", i), d.Income),
+			check(fmt.Sprintf("historical_data[%d].expense", i), d.Expense),
+			check(fmt.Sprintf("historical_data[%d].net_flow", i), d.NetFlow),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i, b := range req.Budget {
+		if err := cmp.Or(
+			check(fmt.Sprintf("budget[%d].income", i), b.Income),
+			check(fmt.Sprintf("budget[%d].expense", i), b.Expense),
+		); err != nil {
+			return err
+		}
+	}
+	// A slice, not a map, so the first non-finite field is always the same
+	for _, f := range []struct {
+		field string
+		value *float64
+	}{
+		{"opening_balance", req.OpeningBalance},
+		{"income_growth_override", req.IncomeGrowthOverride},
+		{"expense_growth_override", req.ExpenseGrowthOverride},
+		{"reinvestment_rate", req.ReinvestmentRate},
+	} {
+		if f.value != nil {
+			if err := check(f.field, *f.value); err != nil {
+				return err
+			}
+		}
+	}
+	if req.CapitalInjection != nil {
+		if err := check("capital_injection.amount", req.CapitalInjection.Amount); err != nil {
+			return err
+		}
+	}
+	return cmp.Or(
+		check("income_ceiling", req.IncomeCeiling),
+		check("expense_cap_ratio", req.ExpenseCapRatio),
+	)
+}
+
+// Analyze strips control characters from the company fields of req,
+// validates it and returns its analysis
+func (fa *FinancialAnalyzer) Analyze(req AnalysisRequest) (*FinancialAnalysis, error) {
+	stripControlCharacters(&req.Company)
+	if err := fa.Validate(req); err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", cmp.Or(req.Company.ID, "request"), err)
+	}
+	return fa.GenerateAnalysis(req), nil
+}
+
+// analyzerAPIError maps an error of Validate to its HTTP status and body
+func analyzerAPIError(err error) (int, APIError) {
+	apiErr := APIError{Message: err.Error()}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		apiErr.Field = fieldErr.Field
+	}
+
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrNonFinite):
+		status, apiErr.Error = http.StatusUnprocessableEntity, "non_finite_number"
+	case errors.Is(err, ErrInvalidMonth):
+		apiErr.Error = "invalid_month"
+	case errors.Is(err, ErrPartialMonth):
+		apiErr.Error = "invalid_partial_month"
+	case errors.Is(err, ErrInsufficientData):
+		apiErr.Error = "insufficient_data"
+	case errors.Is(err, ErrInvalidModelParam):
+		apiErr.Error = "invalid_model_param"
+	case errors.Is(err, ErrCurrencyMismatch):
+		apiErr.Error = "currency_mismatch"
+	case errors.Is(err, ErrStringTooLong):
+		status, apiErr.Error = http.StatusUnprocessableEntity, "string_too_long"
+	default:
+		apiErr.Error = "invalid_request"
+	}
+	return status, apiErr
+}
+
+// GenerateAnalysis creates a complete financial analysis. It expects a
+// request that passed Validate; Analyze does both.
+func (fa *FinancialAnalyzer) GenerateAnalysis(req AnalysisRequest) *FinancialAnalysis {
+	run := fa.runForecast(req)
+	historical, trendHistory, predictions := run.historical, run.trendHistory, run.predictions
+	decomposition, modelOutput, netFlowMode := run.decomposition, run.modelOutput, run.netFlowMode
+	if req.Deltas && len(historical) > 0 {
+		addDeltas(predictions, historical[len(historical)-1])
+	}
+	summary := fa.generateSummary(historical, predictions, !req.SkipRecommendations)
+	applyTone(&summary, fa.Config.ruleCatalog(), req.Tone)
+	params := modelGrowthRates(fa.forecastParams(trendHistory, req), decomposition, req)
+	fa.applyGrowthRates(&summary, params, req.Annualized)
+	summary.NetFlowMode = netFlowMode
+	var equity *float64
+	if req.OpeningBalance != nil {
+		balance := historicalBalance(req.OpeningBalance, historical)
+		equity = &balance
+	}
+	summary.SustainableGrowth = sustainableGrowth(trendHistory, equity, req.ReinvestmentRate, params.IncomeGrowthRate, req.Annualized)
+	summary.ReliableHorizonMonths = reliableHorizon(predictions)
+	summary.ExpenseRatioAlerts = expenseRatioAlerts(predictions, fa.Config.Thresholds.ExpenseRatio)
+	summary.PeakExpenseGrowth = peakExpenseGrowth(historical)
+	summary.Momentum = profitMomentum(trendHistory)
+	summary.LifecyclePhase = lifecyclePhase(trendHistory, summary.Momentum)
+	summary.HalfComparison = compareHalves(trendHistory)
+	summary.SeasonalPhase = fa.seasonalPhase(trendHistory)
+	summary.NetFlowDistribution = netFlowHistogram(historical, fa.Config.HistogramBuckets)
+	summary.PerEmployee = perEmployeeMetrics(summary, req.Company.EmployeeCount)
+	summary.ExpenseCoverageMonths = expenseCoverage(summary, len(historical), len(predictions), req.OpeningBalance)
+	incomeModel, _ := seriesModels(req)
+	summary.VsBenchmark = fa.compareToBenchmark(req.Company.Sector, trendHistory, growthOptionsFor(withModel(req, incomeModel)), req.Annualized)
+
+	seasonality := fa.analyzeSeasonality(trendHistory)
+	var adjustedHistory []AdjustedMonth
+	if req.IncludeSeasonallyAdjusted {
+		adjustedHistory = fa.seasonallyAdjust(trendHistory, req)
+	}
+	if req.SeasonallyAdjusted {
+		seasonality = unappliedSeasonality()
+	}
+	summary.Narrative = forecastNarrative(summary, seasonality)
+
+	var balanceProjection *BalanceProjection
+	var injectionImpact *InjectionImpact
+	if req.OpeningBalance != nil || req.CapitalInjection != nil {
+		var opening float64
+		if req.OpeningBalance != nil {
+			opening = *req.OpeningBalance
+		}
+		balanceProjection = projectBalance(opening, historical, predictions, req.CapitalInjection)
+		if req.CapitalInjection != nil {
+			injectionImpact = compareInjection(*req.CapitalInjection, projectBalance(opening, historical, predictions, nil), balanceProjection, len(historical))
+		}
+	}
+
+	echoed := historical
+	if req.IncludeFullHistory {
+		echoed = req.HistoricalData
+	}
+
+	return &FinancialAnalysis{
+		Company:                   req.Company,
+		HistoricalData:            echoed,
+		HistoryWindow:             len(historical),
+		Predictions:               predictions,
+		Summary:                   summary,
+		Seasonality:               seasonality,
+		Sensitivity:               fa.analyzeSensitivity(trendHistory, req, params, modelOutput),
+		BudgetComparison:          compareToBudget(predictions, req.Budget),
+		BalanceProjection:         balanceProjection,
+		CapitalInjection:          injectionImpact,
+		BiasCorrection:            run.bias,
+		ProratedMonth:             run.prorated,
+		IncomeCeiling:             run.ceiling,
+		ExpenseStep:               detectExpenseStep(trendHistory),
+		ExpenseCap:                run.expenseCap,
+		ZeroFloorMonths:           run.floored,
+		ExpenseFloor:              run.expenseFloor,
+		SeasonallyAdjustedHistory: adjustedHistory,
+		BreakEven:                 simulateBreakEven(predictions, trendHistory, historicalBalance(req.OpeningBalance, historical), req.CapitalInjection, req.Simulations),
+		Decomposition:             decomposition,
+		Warnings:                  fa.dataWarnings(req.Company, historical),
+		CreatedAt:                 fa.now(),
+		modelOutput:               modelOutput,
+	}
+}
+
+// forecastRun is a forecast with every adjustment applied, as analyze
+// returns it, together with the history it was made from and what each
+// adjustment reported
+type forecastRun struct {
+	historical   []FinancialData
+	trendHistory []FinancialData
+	prorated     *ProratedMonth
+	predictions  []FinancialData
+	// modelOutput is the model's forecast before any adjustment
+	modelOutput   []FinancialData
+	decomposition *DecompositionResult
+	bias          *BiasCorrection
+	ceiling       *CeilingReport
+	expenseFloor  *ExpenseFloorReport
+	floored       []string
+	expenseCap    *ExpenseCapReport
+	netFlowMode   string
+}
+
+// runForecast windows and prorates the history, forecasts it with the
+// selected model and applies the bias correction, income ceiling, expense
+// floor, events, zero floor, expense cap, intervals and direct net flow in
+// that order. Analyze and the stress test both start from it, so they
+// report the same forecast.
+func (fa *FinancialAnalyzer) runForecast(req AnalysisRequest) forecastRun {
+	run := forecastRun{historical: windowHistory(req.HistoricalData, req.HistoryWindow)}
+	// The trend learns from the in-progress month scaled to a full month;
+	// totals and balances keep the raw amounts
+	run.trendHistory, run.prorated = prorateLatest(run.historical)
+
+	run.predictions, run.decomposition = fa.predictModel(run.trendHistory, req)
+	run.modelOutput = slices.Clone(run.predictions)
+	componentNetFlows := make([]float64, len(run.predictions))
+	for i, p := range run.predictions {
+		componentNetFlows[i] = p.NetFlow
+	}
+	if fa.store != nil && req.Company.ID != "" {
+		run.bias = fa.store.Bias(req.Company.ID)
+		applyBiasCorrection(run.predictions, run.bias)
+	}
+	run.ceiling = applyIncomeCeiling(run.predictions, req.IncomeCeiling)
+	run.expenseFloor = applyExpenseFloor(run.predictions, req.Company.MonthlyAvgExpense*fa.Config.ProfileExpenseFloor)
+	applyEvents(run.predictions, req.Events)
+	run.floored = applyZeroFloor(run.predictions)
+	run.expenseCap = applyExpenseCap(run.predictions, req.ExpenseCapRatio)
+	addIntervals(run.predictions, run.trendHistory, req.FanLevels)
+	run.netFlowMode = cmp.Or(req.NetFlowMode, netFlowComponents)
+	if run.netFlowMode == netFlowDirect {
+		applyDirectNetFlow(run.predictions, componentNetFlows, fa.forecastNetFlow(run.trendHistory, req, len(run.predictions)))
+	}
+	return run
+}
+
+// projectBalance adds the cumulative net flow of the history and the forecast
+// to the opening balance and reports the trough, the real liquidity risk. An
+// injection raises the balance from its predicted month on.
+func projectBalance(opening float64, historical, predictions []FinancialData, injection *CapitalInjection) *BalanceProjection {
+	projection := &BalanceProjection{OpeningBalance: opening, MinBalance: math.Inf(1)}
+
+	var cumulative, injected float64
+	add := func(months []FinancialData, kind string) {
+		for _, m := range months {
+			cumulative += m.NetFlow
+			var inflow float64
+			if injection != nil && kind == "predicted" && m.Month == injection.Month {
+				inflow = injection.Amount
+				injected += inflow
+			}
+			balance := opening + cumulative + injected
+			projection.Months = append(projection.Months, BalancePoint{
+				Month:             m.Month,
+				Type:              kind,
+				NetFlow:           m.NetFlow,
+				CumulativeNetFlow: math.Round(cumulative*100) / 100,
+				Injection:         inflow,
+				Balance:           math.Round(balance*100) / 100,
+			})
+			if balance < projection.MinBalance {
+				projection.MinBalance = math.Round(balance*100) / 100
+				projection.MinBalanceMonth = m.Month
+			}
+		}
+	}
+	add(historical, "historical")
+	add(predictions, "predicted")
+
+	if len(projection.Months) == 0 {
+		projection.MinBalance = opening
+	}
+	projection.GoesNegative = projection.MinBalance < 0
+	return projection
+}
+
+// BalanceOutlook is the forecast part of a balance projection: the months
+// of runway before the balance turns negative and the trough
+type BalanceOutlook struct {
+	RunwayMonths    int     `json:"runway_months"`
+	RunsOutOfCash   bool    `json:"runs_out_of_cash"`
+	MinBalance      float64 `json:"min_balance"`
+	MinBalanceMonth string  `json:"min_balance_month"`
+}
+
+// balanceOutlook counts the forecast months of projection, after its
+// historyLen historical months, until the balance turns negative, and finds
+// the trough among them. Without forecast months the projection's own
+// trough stands.
+func balanceOutlook(projection *BalanceProjection, historyLen int) BalanceOutlook {
+	forecast := projection.Months[historyLen:]
+	if len(forecast) == 0 {
+		return BalanceOutlook{MinBalance: projection.MinBalance, MinBalanceMonth: projection.MinBalanceMonth}
+	}
+	outlook := BalanceOutlook{MinBalance: math.Inf(1)}
+	for _, point := range forecast {
+		if point.Balance < outlook.MinBalance {
+			outlook.MinBalance, outlook.MinBalanceMonth = point.Balance, point.Month
+		}
+		if point.Balance < 0 {
+			outlook.RunsOutOfCash = true
+		}
+		if !outlook.RunsOutOfCash {
+			outlook.RunwayMonths++
+		}
+	}
+	return outlook
+}
+
+// InjectionImpact compares the balance outlook with and without a capital
+// injection. RunwayGain is the extra months of runway and MinBalanceChange
+// how far the trough rose.
+type InjectionImpact struct {
+	CapitalInjection
+	Without          BalanceOutlook `json:"without"`
+	With             BalanceOutlook `json:"with"`
+	RunwayGain       int            `json:"runway_gain"`
+	MinBalanceChange float64        `json:"min_balance_change"`
+}
+
+// compareInjection reports how injection changes the runway and trough of
+// the projection without it
+func compareInjection(injection CapitalInjection, without, with *BalanceProjection, historyLen int) *InjectionImpact {
+	impact := &InjectionImpact{
+		CapitalInjection: injection,
+		Without:          balanceOutlook(without, historyLen),
+		With:             balanceOutlook(with, historyLen),
+	}
+	impact.RunwayGain = impact.With.RunwayMonths - impact.Without.RunwayMonths
+	impact.MinBalanceChange = math.Round((impact.With.MinBalance-impact.Without.MinBalance)*100) / 100
+	return impact
+}
+
+// compareToBudget measures the forecast against the budget targets. A month
+// is on track when its forecast net flow reaches the budgeted net flow. The
+// company is Hedefte when the total net-flow variance is not negative and
+// Sınırda when the shortfall stays within 5% of the budgeted net flow.
+func compareToBudget(predictions []FinancialData, budget []BudgetTarget) *BudgetComparison {
+	if len(budget) == 0 {
+		return nil
+	}
+
+	comparison := &BudgetComparison{}
+	var incomeVariance, expenseVariance, budgetNetFlow float64
+	for _, p := range predictions {
+		i := slices.IndexFunc(budget, func(b BudgetTarget) bool { return b.Month == p.Month })
+		if i < 0 {
+			continue
+		}
+		b := budget[i]
+
+		v := BudgetVariance{
+			Month:           p.Month,
+			BudgetIncome:    b.Income,
+			ForecastIncome:  p.Income,
+			IncomeVariance:  math.Round((p.Income-b.Income)*100) / 100,
+			BudgetExpense:   b.Expense,
+			ForecastExpense: p.Expense,
+			ExpenseVariance: math.Round((p.Expense-b.Expense)*100) / 100,
+			NetFlowVariance: math.Round((p.NetFlow-(b.Income-b.Expense))*100) / 100,
+		}
+		v.OnTrack = v.NetFlowVariance >= 0
+		if !v.OnTrack {
+			comparison.MissedMonths = append(comparison.MissedMonths, p.Month)
+		}
+		comparison.Months = append(comparison.Months, v)
+
+		incomeVariance += p.Income - b.Income
+		expenseVariance += p.Expense - b.Expense
+		budgetNetFlow += b.Income - b.Expense
+	}
+
+	netFlowVariance := incomeVariance - expenseVariance
+	comparison.TotalIncomeVariance = math.Round(incomeVariance*100) / 100
+	comparison.TotalExpenseVariance = math.Round(expenseVariance*100) / 100
+	comparison.TotalNetFlowVariance = math.Round(netFlowVariance*100) / 100
+
+	switch {
+	case netFlowVariance >= 0:
+		comparison.Verdict = "Hedefte"
+	case -netFlowVariance <= 0.05*math.Abs(budgetNetFlow):
+		comparison.Verdict = "Sınırda"
+	default:
+		comparison.Verdict = "Hedefin Gerisinde"
+	}
+
+	return comparison
+}
+
+// peakExpenseGrowth finds the historical month with the highest
+// month-over-month expense growth, the spike the average growth rate hides.
+// Returns nil when no month follows a positive expense.
+func peakExpenseGrowth(historical []FinancialData) *MonthlyGrowth {
+	var peak *MonthlyGrowth
+	for i := 1; i < len(historical); i++ {
+		previous := historical[i-1].Expense
+		if previous <= 0 {
+			continue
+		}
+		growth := (historical[i].Expense - previous) / previous
+		if peak == nil || growth > peak.GrowthRate {
+			peak = &MonthlyGrowth{Month: historical[i].Month, GrowthRate: growth}
+		}
+	}
+	if peak != nil {
+		peak.GrowthRate = math.Round(peak.GrowthRate*10000) / 10000
+	}
+	return peak
+}
+
+// Bases of the sustainable growth rate
+const (
+	// growthBasisEquity takes the return on the cash balance as the return
+	// on equity of the textbook formula
+	growthBasisEquity = "equity"
+	// growthBasisMargin substitutes the net margin, a heuristic for
+	// requests without an opening balance
+	growthBasisMargin = "margin"
+)
+
+// SustainableGrowth is the fastest income growth the company can fund from
+// its own net flow, set against the growth the forecast assumes
+type SustainableGrowth struct {
+	// Basis is equity or margin, the return the rate is derived from
+	Basis string `json:"basis"`
+	// NetMargin is the historical net flow as a share of income
+	NetMargin float64 `json:"net_margin"`
+	// ReturnOnEquity is the average monthly net flow as a share of the
+	// balance at the end of the history; set on the equity basis only
+	ReturnOnEquity   *float64 `json:"return_on_equity,omitempty"`
+	ReinvestmentRate float64  `json:"reinvestment_rate"`
+	// Rate is per RatePeriod of the summary, like income_growth_rate
+	Rate float64 `json:"rate"`
+	// RequiresExternalFunding is set when the forecast's income growth
+	// exceeds Rate, i.e. the forecast implicitly assumes outside funding.
+	// Only the equity basis supports that conclusion, so it is nil on the
+	// margin basis.
+	RequiresExternalFunding *bool `json:"requires_external_funding,omitempty"`
+}
+
+// sustainableGrowth derives the sustainable growth rate r·b / (1 - r·b)
+// from a monthly return r and the reinvestment rate b. With the balance at
+// the end of the history as equity, r is the textbook return on equity: the
+// average monthly net flow over that balance. Without one the net margin
+// stands in for r, a heuristic that only says how fast retained flow could
+// fund the expense of extra income, so it raises no funding flag. A company
+// that does not net a positive flow cannot fund any growth itself. The
+// comparison uses the unrounded monthly income growth of the forecast. The
+// margin takes the reported net flow, which trust_net_flow may keep apart
+// from income minus expense. Returns nil when the history has no income, or
+// no expense to fund.
+func sustainableGrowth(historical []FinancialData, equity *float64, reinvestment *float64, incomeGrowth float64, annualized bool) *SustainableGrowth {
+	var income, expense, netFlow float64
+	for _, d := range historical {
+		income += d.Income
+		expense += d.Expense
+		netFlow += d.NetFlow
+	}
+	if income <= 0 || expense <= 0 {
+		return nil
+	}
+	b := 1.0
+	if reinvestment != nil {
+		b = *reinvestment
+	}
+	margin := netFlow / income
+	sg := &SustainableGrowth{
+		Basis:            growthBasisMargin,
+		NetMargin:        math.Round(margin*10000) / 10000,
+		ReinvestmentRate: b,
+	}
+	r := margin
+	if equity != nil && *equity > 0 {
+		r = netFlow / float64(len(historical)) / *equity
+		roe := math.Round(r*10000) / 10000
+		sg.Basis, sg.ReturnOnEquity = growthBasisEquity, &roe
+	}
+	var rate float64
+	if retained := r * b; retained > 0 && retained < 1 {
+		rate = retained / (1 - retained)
+	}
+	if sg.Basis == growthBasisEquity {
+		external := incomeGrowth > rate
+		sg.RequiresExternalFunding = &external
+	}
+	if annualized {
+		rate = annualizeRate(rate)
+	}
+	sg.Rate = math.Round(rate*10000) / 10000
+	return sg
+}
+
+// compareHalves compares the net flow of the two halves of the history.
+// Returns nil below two months.
+func compareHalves(historical []FinancialData) *HalfComparison {
+	half := len(historical) / 2
+	if half == 0 {
+		return nil
+	}
+
+	var first, second float64
+	for _, h := range historical[:half] {
+		first += h.NetFlow
+	}
+	for _, h := range historical[len(historical)-half:] {
+		second += h.NetFlow
+	}
+
+	comparison := &HalfComparison{
+		HalfMonths:        half,
+		FirstHalfNetFlow:  math.Round(first*100) / 100,
+		SecondHalfNetFlow: math.Round(second*100) / 100,
+		Change:            math.Round((second-first)*100) / 100,
+	}
+	if first != 0 {
+		pct := math.Round((second-first)/math.Abs(first)*10000) / 10000
+		comparison.ChangePct = &pct
+	}
+	return comparison
+}
+
+// profitMomentum compares consecutive net flow changes: a growing change is
+// acceleration, a shrinking one deceleration. The acceleration is the
+// curvature of the least-squares parabola through the net flow rather than
+// the average second difference, which telescopes to (last change - first
+// change) / (n-2) and so ignores every month in between. It counts as
+// steady when under 1% of the average net flow size, the same flatness rule
+// as the trend endpoint. Returns nil below three months.
+func profitMomentum(historical []FinancialData) *ProfitMomentum {
+	if len(historical) < 3 {
+		return nil
+	}
+
+	var absNetFlow float64
+	netFlows := make([]float64, len(historical))
+	for i, h := range historical {
+		netFlows[i] = h.NetFlow
+		absNetFlow += math.Abs(h.NetFlow)
+	}
+	secondDiffs := make([]float64, len(historical)-2)
+	for i := range secondDiffs {
+		secondDiffs[i] = historical[i+2].NetFlow - 2*historical[i+1].NetFlow + historical[i].NetFlow
+	}
+	acceleration := curvature(netFlows)
+
+	code := momentumSteady
+	if math.Abs(acceleration) >= 0.01*absNetFlow/float64(len(historical)) {
+		code = momentumAccelerating
+		if acceleration < 0 {
+			code = momentumDecelerating
+		}
+	}
+
+	momentum := &ProfitMomentum{
+		State:        verdictLabels[code],
+		StateCode:    code,
+		Acceleration: math.Round(acceleration*100) / 100,
+	}
+	// secondDiffs[i] is centred on month i+1, so a sign change between
+	// secondDiffs[i-1] and secondDiffs[i] first shows in month i+1
+	for i := len(secondDiffs) - 1; i > 0; i-- {
+		if secondDiffs[i]*secondDiffs[i-1] < 0 {
+			momentum.InflectionMonth = historical[i+1].Month
+			break
+		}
+	}
+	return momentum
+}
+
+// curvature returns the second derivative 2a of the least-squares parabola
+// a·x² + b·x + c through values. With x centred on the middle month the
+// quadratic term x² - mean(x²) is orthogonal to the constant and linear
+// terms, so a is its projection alone. Three values give the plain second
+// difference.
+func curvature(values []float64) float64 {
+	n := len(values)
+	if n < 3 {
+		return 0
+	}
+	mid := float64(n-1) / 2
+	var meanSquare float64
+	for i := range values {
+		meanSquare += (float64(i) - mid) * (float64(i) - mid)
+	}
+	meanSquare /= float64(n)
+
+	var num, den float64
+	for i, v := range values {
+		q := (float64(i)-mid)*(float64(i)-mid) - meanSquare
+		num += q * v
+		den += q * q
+	}
+	return 2 * num / den
+}
+
+// lifecyclePhase combines the net flow trend with its momentum: a flat trend,
+// under 1% of the average net flow size per month like the momentum, is a
+// plateau and a falling one decline. A rising trend is growth only while the
+// momentum accelerates; rising at a steady or slowing pace is mature.
+// Returns nil without a momentum.
+func lifecyclePhase(historical []FinancialData, momentum *ProfitMomentum) *LifecyclePhase {
+	if momentum == nil {
+		return nil
+	}
+
+	netFlows := make([]float64, len(historical))
+	var absNetFlow float64
+	for i, h := range historical {
+		netFlows[i] = h.NetFlow
+		absNetFlow += math.Abs(h.NetFlow)
+	}
+	_, slope := linearFit(netFlows)
+
+	code := phaseMature
+	switch {
+	case math.Abs(slope) < 0.01*absNetFlow/float64(len(historical)):
+		code = phasePlateau
+	case slope < 0:
+		code = phaseDecline
+	case momentum.StateCode == momentumAccelerating:
+		code = phaseGrowth
+	}
+	return &LifecyclePhase{
+		Phase:     verdictLabels[code],
+		PhaseCode: code,
+		Slope:     math.Round(slope*100) / 100,
+	}
+}
+
+// expenseCoverage divides the cash accumulated by the end of each period by
+// that period's average monthly expense. A negative cash position covers
+// nothing and reports zero.
+func expenseCoverage(summary AnalysisSummary, historyLen, predictionLen int, openingBalance *float64) ExpenseCoverage {
+	coverage := ExpenseCoverage{Basis: "net_flow"}
+	var cash float64
+	if openingBalance != nil {
+		cash = *openingBalance
+		coverage.Basis = "opening_balance"
+	}
+
+	months := func(cash, totalExpense float64, n int) float64 {
+		if n == 0 || totalExpense <= 0 || cash <= 0 {
+			return 0
+		}
+		return math.Round(cash/(totalExpense/float64(n))*100) / 100
+	}
+
+	cash += summary.TotalHistoricalNetFlow
+	coverage.Historical = months(cash, summary.TotalHistoricalExpense, historyLen)
+	cash += summary.PredictedTotalNetFlow
+	coverage.Predicted = months(cash, summary.PredictedTotalExpense, predictionLen)
+	return coverage
+}
+
+// perEmployeeMetrics divides the summary totals by employees. Returns nil
+// when the employee count is unknown.
+func perEmployeeMetrics(summary AnalysisSummary, employees int) *PerEmployeeMetrics {
+	if employees <= 0 {
+		return nil
+	}
+
+	perEmployee := func(total float64) float64 {
+		return math.Round(total/float64(employees)*100) / 100
+	}
+	return &PerEmployeeMetrics{
+		EmployeeCount:     employees,
+		HistoricalIncome:  perEmployee(summary.TotalHistoricalIncome),
+		HistoricalExpense: perEmployee(summary.TotalHistoricalExpense),
+		HistoricalNetFlow: perEmployee(summary.TotalHistoricalNetFlow),
+		PredictedIncome:   perEmployee(summary.PredictedTotalIncome),
+		PredictedExpense:  perEmployee(summary.PredictedTotalExpense),
+		PredictedNetFlow:  perEmployee(summary.PredictedTotalNetFlow),
+	}
+}
+
+// netFlowHistogram buckets the historical monthly net flows into equal-width
+// buckets between their minimum and maximum, showing how often the company
+// dipped negative. Returns nil for an empty history.
+func netFlowHistogram(historical []FinancialData, buckets int) *NetFlowHistogram {
+	if len(historical) == 0 {
+		return nil
+	}
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	values := make([]float64, len(historical))
+	negative := 0
+	for i, h := range historical {
+		values[i] = h.NetFlow
+		if h.NetFlow < 0 {
+			negative++
+		}
+	}
+	slices.Sort(values)
+
+	lo, hi := values[0], values[len(values)-1]
+	if lo == hi {
+		buckets = 1 // All months are equal; more buckets would be empty
+	}
+
+	median := values[len(values)/2]
+	if len(values)%2 == 0 {
+		median = (values[len(values)/2-1] + values[len(values)/2]) / 2
+	}
+
+	width := (hi - lo) / float64(buckets)
+	histogram := &NetFlowHistogram{
+		Buckets:        make([]HistogramBucket, buckets),
+		Min:            lo,
+		Max:            hi,
+		Median:         math.Round(median*100) / 100,
+		NegativeMonths: negative,
+	}
+	for i := range histogram.Buckets {
+		histogram.Buckets[i].From = math.Round((lo+width*float64(i))*100) / 100
+		histogram.Buckets[i].To = math.Round((lo+width*float64(i+1))*100) / 100
+	}
+	histogram.Buckets[buckets-1].To = hi
+
+	for _, v := range values {
+		i := buckets - 1
+		if width > 0 {
+			i = min(int((v-lo)/width), buckets-1)
+		}
+		histogram.Buckets[i].Count++
+	}
+
+	return histogram
+}
+
+// expenseRatioAlerts lists the predicted months whose expense/income ratio
+// exceeds threshold, so a single tight month is not hidden by healthy totals.
+// Months without income but with expenses are always flagged.
+func expenseRatioAlerts(predictions []FinancialData, threshold float64) []ExpenseRatioAlert {
+	var alerts []ExpenseRatioAlert
+	for _, p := range predictions {
+		if p.Income <= 0 {
+			if p.Expense > 0 {
+				alerts = append(alerts, ExpenseRatioAlert{Month: p.Month})
+			}
+			continue
+		}
+
+		ratio := math.Round(p.Expense/p.Income*10000) / 10000
+		if ratio > threshold {
+			alerts = append(alerts, ExpenseRatioAlert{Month: p.Month, ExpenseRatio: &ratio})
+		}
+	}
+	return alerts
+}
+
+// forecastNarrative explains the forecast in a short Turkish paragraph built
+// from the summary's growth rates and verdicts and the seasonal peak month
+func forecastNarrative(summary AnalysisSummary, seasonality SeasonalityInfo) string {
+	period := "aylık"
+	if summary.RatePeriod == "annual" {
+		period = "yıllık"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Gelirin %s %s bekleniyor", period, growthPhrase(summary.IncomeGrowthRate))
+	switch summary.GrowthTrendCode {
+	case trendUp:
+		b.WriteString("; bu tahmin son dönemdeki yükseliş eğilimine dayanıyor")
+	case trendDown:
+		b.WriteString("; bu tahmin son dönemdeki düşüş eğilimini yansıtıyor")
+	}
+	b.WriteString(". ")
+
+	if !seasonality.Applied {
+		b.WriteString("Veriler mevsimsellikten arındırılmış olduğundan mevsimsel düzeltme uygulanmadı. ")
+	} else if peak := slices.Index(seasonality.Factors, slices.Max(seasonality.Factors)); peak >= 0 {
+		fmt.Fprintf(&b, "Mevsimsel zirve %s ayında. ", turkishMonths[peak])
+	}
+
+	fmt.Fprintf(&b, "Giderlerin %s %s öngörülüyor. ", period, growthPhrase(summary.ExpenseGrowthRate))
+	fmt.Fprintf(&b, "Risk seviyesi %s, nakit akışı %s.", summary.RiskLevel, summary.CashFlowHealth)
+
+	return b.String()
+}
+
+// growthPhrase describes a growth rate in words, e.g. "yaklaşık %3,0 artması"
+func growthPhrase(rate float64) string {
+	if math.Abs(rate) < 0.005 {
+		return "yatay seyretmesi"
+	}
+
+	verb := "artması"
+	if rate < 0 {
+		verb = "azalması"
+	}
+	pct := strings.Replace(fmt.Sprintf("%.1f", math.Abs(rate)*100), ".", ",", 1)
+	return fmt.Sprintf("yaklaşık %%%s %s", pct, verb)
+}
+
+// dataWarnings flags suspicious patterns in the historical data
+func (fa *FinancialAnalyzer) dataWarnings(company CompanyProfile, historical []FinancialData) []AnalysisWarning {
+	var warnings []AnalysisWarning
+
+	if reference, mismatched := currencyMismatches(company, historical); len(mismatched) > 0 {
+		months := make([]string, len(mismatched))
+		for i, index := range mismatched {
+			months[i] = historical[index].Month
+		}
+		warnings = append(warnings, AnalysisWarning{
+			Code:    "currency_mismatch",
+			Message: fmt.Sprintf("Bazı aylar %s dışında bir para biriminde: tutarlar dönüştürülmeden karıştırıldıysa tüm sonuçlar hatalıdır", reference),
+			Months:  months,
+		})
+	}
+
+	var zeroIncomeMonths []string
+	for _, h := range historical {
+		if h.Income == 0 {
+			zeroIncomeMonths = append(zeroIncomeMonths, h.Month)
+		}
+	}
+	if len(zeroIncomeMonths) > 0 {
+		warnings = append(warnings, AnalysisWarning{
+			Code:    "zero_income_months",
+			Message: "Gelirin sıfır olduğu aylar var: veri eksikliği veya ciddi bir gelir kaybı olabilir",
+			Months:  zeroIncomeMonths,
+		})
+	}
+
+	if identicalNetFlows(historical) {
+		warnings = append(warnings, AnalysisWarning{
+			Code:    "insufficient_variation",
+			Message: "Tüm ayların net akışı aynı: tahmin güveni değişkenlik olmadığından düşürüldü, veriler örnek veri olabilir",
+		})
+	}
+
+	if possibleSwappedColumns(historical, fa.Config.Thresholds.SwappedColumns) {
+		warnings = append(warnings, AnalysisWarning{
+			Code:    "possible_swapped_columns",
+			Message: "Giderler neredeyse her ay geliri aşıyor ve net akış düşüyor: gelir ve gider sütunları yer değiştirmiş olabilir",
+		})
+	}
+
+	return warnings
+}
+
+// possibleSwappedColumns reports whether expenses exceed income in at least
+// the given share of at least three historical months while the net flow
+// trends down, the signature of income and expense columns entered swapped
+func possibleSwappedColumns(historical []FinancialData, share float64) bool {
+	if len(historical) < 3 {
+		return false
+	}
+
+	overspent := 0
+	netFlows := make([]float64, len(historical))
+	for i, h := range historical {
+		if h.Expense > h.Income {
+			overspent++
+		}
+		netFlows[i] = h.NetFlow
+	}
+	_, slope := linearFit(netFlows)
+
+	return float64(overspent)/float64(len(historical)) >= share && slope < 0
+}
+
+// validateEvents checks that every event targets one of forecastMonths
+func (fa *FinancialAnalyzer) validateEvents(events []ForecastEvent, forecastMonths []string) error {
+	for _, e := range events {
+		if fa.getMonthIndex(e.Month) < 0 {
+			return fmt.Errorf("%w: unknown event month %q", ErrInvalidMonth, e.Month)
+		}
+		if !slices.Contains(forecastMonths, e.Month) {
+			return fmt.Errorf("%w: event month %q is outside the forecast horizon", ErrInvalidMonth, e.Month)
+		}
+	}
+	return nil
+}
+
+// validateInjection checks that a capital injection is positive and lands in
+// one of forecastMonths
+func (fa *FinancialAnalyzer) validateInjection(injection *CapitalInjection, forecastMonths []string) error {
+	if injection == nil {
+		return nil
+	}
+	if injection.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if fa.getMonthIndex(injection.Month) < 0 {
+		return fmt.Errorf("%w: unknown injection month %q", ErrInvalidMonth, injection.Month)
+	}
+	if !slices.Contains(forecastMonths, injection.Month) {
+		return fmt.Errorf("%w: injection month %q is outside the forecast horizon", ErrInvalidMonth, injection.Month)
+	}
+	return nil
+}
+
+// validateProration checks that only the latest month is marked in progress
+// and that its day counts describe a real partial month
+func validateProration(history []FinancialData) error {
+	for i, d := range history {
+		if d.DaysElapsed == 0 && d.DaysInMonth == 0 {
+			continue
+		}
+		if i != len(history)-1 {
+			return fmt.Errorf("only the latest month can be partial, but %q has days_elapsed/days_in_month", d.Month)
+		}
+		if d.DaysInMonth < 28 || d.DaysInMonth > 31 {
+			return fmt.Errorf("days_in_month of %q must be between 28 and 31", d.Month)
+		}
+		if d.DaysElapsed < 1 || d.DaysElapsed > d.DaysInMonth {
+			return fmt.Errorf("days_elapsed of %q must be between 1 and days_in_month", d.Month)
+		}
+	}
+	return nil
+}
+
+// prorateLatest returns history with an in-progress latest month scaled to a
+// full-month estimate, and the estimate. History without a partial month is
+// returned unchanged with a nil estimate.
+func prorateLatest(history []FinancialData) ([]FinancialData, *ProratedMonth) {
+	if len(history) == 0 {
+		return history, nil
+	}
+	last := history[len(history)-1]
+	if last.DaysElapsed <= 0 || last.DaysInMonth <= 0 || last.DaysElapsed >= last.DaysInMonth {
+		return history, nil
+	}
+
+	scale := float64(last.DaysInMonth) / float64(last.DaysElapsed)
+	last.Income = math.Round(last.Income*scale*100) / 100
+	last.Expense = math.Round(last.Expense*scale*100) / 100
+	last.NetFlow = math.Round(last.NetFlow*scale*100) / 100
+
+	prorated := slices.Clone(history)
+	prorated[len(prorated)-1] = last
+	return prorated, &ProratedMonth{
+		Month:            last.Month,
+		DaysElapsed:      last.DaysElapsed,
+		DaysInMonth:      last.DaysInMonth,
+		EstimatedIncome:  last.Income,
+		EstimatedExpense: last.Expense,
+	}
+}
+
+// validateBudget checks that every budget target names one of
+// forecastMonths once
+func (fa *FinancialAnalyzer) validateBudget(budget []BudgetTarget, forecastMonths []string) error {
+	seen := make(map[string]bool, len(budget))
+	for _, b := range budget {
+		if fa.getMonthIndex(b.Month) < 0 {
+			return fmt.Errorf("%w: unknown budget month %q", ErrInvalidMonth, b.Month)
+		}
+		if !slices.Contains(forecastMonths, b.Month) {
+			return fmt.Errorf("%w: budget month %q is outside the forecast horizon", ErrInvalidMonth, b.Month)
+		}
+		if seen[b.Month] {
+			return fmt.Errorf("%w: budget month %q is listed more than once", ErrInvalidMonth, b.Month)
+		}
+		seen[b.Month] = true
+	}
+	return nil
+}
+
+// analyzeCached returns the analysis for req, reusing a cached result for an
+// identical request. Cache hits get a fresh CreatedAt timestamp.
+func (fa *FinancialAnalyzer) analyzeCached(req AnalysisRequest) *FinancialAnalysis {
+	if fa.cache == nil {
+		return fa.GenerateAnalysis(req)
+	}
+
+	key, err := fa.requestKey(req)
+	if err != nil {
+		return fa.GenerateAnalysis(req)
+	}
+
+	if cached, ok := fa.cache.Get(key); ok {
+		analysis := *cached
+		analysis.CreatedAt = fa.now()
+		return &analysis
+	}
+
+	analysis := fa.GenerateAnalysis(req)
+	fa.cache.Add(key, analysis)
+
+	// Hand out a copy so callers can set the ID without touching the cache
+	result := *analysis
+	return &result
+}
+
+// runAnalysis produces the analysis for req and stores it under a new ID
+func (fa *FinancialAnalyzer) runAnalysis(req AnalysisRequest) *FinancialAnalysis {
+	analysis := fa.newAnalysis(req)
+	fa.saveAnalysis(req, analysis)
+	return analysis
+}
+
+// newAnalysis produces the analysis for req with a new ID without storing
+// it, for callers that may still discard it
+func (fa *FinancialAnalyzer) newAnalysis(req AnalysisRequest) *FinancialAnalysis {
+	analysis := fa.analyzeCached(req)
+	analysis.ID = newAnalysisID()
+	return analysis
+}
+
+// saveAnalysis stores an analysis from newAnalysis
+func (fa *FinancialAnalyzer) saveAnalysis(req AnalysisRequest, analysis *FinancialAnalysis) {
+	if fa.store != nil {
+		fa.store.Save(req, analysis)
+	}
+}
+
+// rerunAnalysis replays a stored request with the overrides of rerun and
+// stores the result as a new analysis. A config override bypasses the cache,
+// whose keys do not cover the configuration.
+func (fa *FinancialAnalyzer) rerunAnalysis(stored storedAnalysis, rerun RerunRequest) (*FinancialAnalysis, error) {
+	req := stored.Request
+	if rerun.Model != "" {
+		req = withModel(req, rerun.Model)
+	}
+
+	analyzer := fa
+	if len(rerun.Config) > 0 {
+		scoped := *fa
+		scoped.Config = fa.Config.clone()
+		if err := json.Unmarshal(rerun.Config, &scoped.Config); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		// The override is held to the same checks as a config file
+		if err := validateConfig(scoped.Config); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		scoped.cache = nil
+		analyzer = &scoped
+	}
+
+	analysis := analyzer.runAnalysis(req)
+	analysis.RerunOf = stored.Analysis.ID
+	return analysis, nil
+}
+
+// compareActuals matches realized months to the stored predictions by month name
+func (fa *FinancialAnalyzer) compareActuals(stored storedAnalysis, actuals []FinancialData) ActualsComparison {
+	comparison := ActualsComparison{
+		AnalysisID: stored.Analysis.ID,
+		CompanyID:  stored.Analysis.Company.ID,
+		ComparedAt: fa.now(),
+	}
+
+	var totalAPE float64
+	var apeCount int
+
+	for _, actual := range actuals {
+		idx := slices.IndexFunc(stored.Analysis.Predictions, func(p FinancialData) bool {
+			return p.Month == actual.Month
+		})
+		if idx < 0 {
+			comparison.UnmatchedMonths = append(comparison.UnmatchedMonths, actual.Month)
+			continue
+		}
+
+		predicted := stored.Analysis.Predictions[idx]
+		model := predicted
+		if idx < len(stored.Analysis.modelOutput) {
+			model = stored.Analysis.modelOutput[idx]
+		}
+		actualNetFlow := actual.Income - actual.Expense
+		m := MonthlyForecastError{
+			Month:            actual.Month,
+			PredictedIncome:  predicted.Income,
+			ActualIncome:     actual.Income,
+			IncomeError:      math.Round((actual.Income-predicted.Income)*100) / 100,
+			PredictedExpense: predicted.Expense,
+			ActualExpense:    actual.Expense,
+			ExpenseError:     math.Round((actual.Expense-predicted.Expense)*100) / 100,
+			PredictedNetFlow: predicted.NetFlow,
+			ActualNetFlow:    math.Round(actualNetFlow*100) / 100,
+			NetFlowError:     math.Round((actualNetFlow-predicted.NetFlow)*100) / 100,
+			modelIncome:      model.Income,
+			modelExpense:     model.Expense,
+		}
+
+		if predicted.Income != 0 {
+			pct := (actual.Income - predicted.Income) / predicted.Income
+			m.IncomeErrorPct = math.Round(pct*10000) / 10000
+			totalAPE += math.Abs(pct)
+			apeCount++
+		}
+		if predicted.Expense != 0 {
+			pct := (actual.Expense - predicted.Expense) / predicted.Expense
+			m.ExpenseErrorPct = math.Round(pct*10000) / 10000
+			totalAPE += math.Abs(pct)
+			apeCount++
+		}
+
+		comparison.Months = append(comparison.Months, m)
+	}
+
+	if apeCount > 0 {
+		comparison.MAPE = math.Round(totalAPE/float64(apeCount)*10000) / 10000
+	}
+
+	comparison.Accuracy = "Düşük"
+	if comparison.MAPE < 0.10 {
+		comparison.Accuracy = "Yüksek"
+	} else if comparison.MAPE < 0.25 {
+		comparison.Accuracy = "Orta"
+	}
+
+	return comparison
+}
+
+// AuditEntry records who asked for which analysis and what it concluded
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	// APIKey is a fingerprint of the caller's X-API-Key, never the key itself
+	APIKey    string `json:"api_key,omitempty"`
+	CompanyID string `json:"company_id"`
+	// RequestHash is the SHA-256 of the request body as received
+	RequestHash   string  `json:"request_hash"`
+	AnalysisID    string  `json:"analysis_id"`
+	RiskLevelCode string  `json:"risk_level_code"`
+	RiskScore     float64 `json:"risk_score"`
+}
+
+// The audit log keeps the latest auditRecentEntries in memory for the admin
+// endpoint; up to auditQueueSize entries wait for the file writer
+const (
+	auditRecentEntries = 1000
+	auditQueueSize     = 256
+)
+
+// auditLog is the append-only record of analyze calls. Entries are kept in
+// memory and, once attachFile is called, appended to a JSON lines file by a
+// background writer, so a slow or failing file never delays a response:
+// when the writer falls behind entries are counted as dropped instead.
+type auditLog struct {
+	mu      sync.Mutex
+	recent  []AuditEntry
+	queue   chan AuditEntry
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{}
+}
+
+// attachFile starts appending entries to the file at path
+func (a *auditLog) attachFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	a.queue = make(chan AuditEntry, auditQueueSize)
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		defer file.Close()
+		encoder := json.NewEncoder(file)
+		for e := range a.queue {
+			if err := encoder.Encode(e); err != nil {
+				a.dropped.Add(1)
+				logger.Error("writing audit entry failed", "analysis_id", e.AnalysisID, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Record adds e to the log without waiting for the file
+func (a *auditLog) Record(e AuditEntry) {
+	a.mu.Lock()
+	a.recent = append(a.recent, e)
+	if len(a.recent) > auditRecentEntries {
+		a.recent = slices.Delete(a.recent, 0, len(a.recent)-auditRecentEntries)
+	}
+	a.mu.Unlock()
+
+	if a.queue == nil {
+		return
+	}
+	select {
+	case a.queue <- e:
+	default:
+		a.dropped.Add(1)
+		logger.Error("audit queue full, entry not written", "analysis_id", e.AnalysisID)
+	}
+}
+
+// Recent returns up to limit entries, newest first, optionally only those of
+// one company
+func (a *auditLog) Recent(limit int, companyID string) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := make([]AuditEntry, 0, min(limit, len(a.recent)))
+	for i := len(a.recent) - 1; i >= 0 && len(entries) < limit; i-- {
+		if companyID == "" || a.recent[i].CompanyID == companyID {
+			entries = append(entries, a.recent[i])
+		}
+	}
+	return entries
+}
+
+// Close flushes the queued entries to the file
+func (a *auditLog) Close() {
+	if a.queue == nil {
+		return
+	}
+	close(a.queue)
+	<-a.done
+}
+
+// auditEntry builds the audit record of an analyze call; requestHash is the
+// hex SHA-256 of the body as received
+func (fa *FinancialAnalyzer) auditEntry(r *http.Request, requestHash string, analysis *FinancialAnalysis) AuditEntry {
+	entry := AuditEntry{
+		Time:          fa.now(),
+		TenantID:      fa.tenantID,
+		CompanyID:     analysis.Company.ID,
+		AnalysisID:    analysis.ID,
+		RiskLevelCode: analysis.Summary.RiskLevelCode,
+		RiskScore:     analysis.Summary.RiskScore,
+		RequestHash:   requestHash,
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		keySum := sha256.Sum256([]byte(key))
+		entry.APIKey = hex.EncodeToString(keySum[:4])
+	}
+	return entry
+}
+
+// requestKey hashes the tenant and normalized request together with the
+// current month, since the forecast months are labelled relative to today
+func (fa *FinancialAnalyzer) requestKey(req AnalysisRequest) (string, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(fa.tenantID))
+	h.Write(payload)
+	h.Write([]byte(fa.now().Format("2006-01")))
+	// New actuals change the company's bias correction
+	if fa.store != nil {
+		fmt.Fprintf(h, "|%d", fa.store.ComparisonRevision(req.Company.ID))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// windowHistory returns the most recent window months of data, or all of it
+// when window is zero or covers the whole series
+func windowHistory(data []FinancialData, window int) []FinancialData {
+	if window <= 0 || window >= len(data) {
+		return data
+	}
+	return data[len(data)-window:]
+}
+
+// generateSummary creates analysis summary. Without recommend the
+// recommendation lists are left empty, saving their generation and ranking.
+func (fa *FinancialAnalyzer) generateSummary(historical, predicted []FinancialData, recommend bool) AnalysisSummary {
+	var histIncome, histExpense, histNetFlow float64
+	var predIncome, predExpense, predNetFlow float64
+	var positiveMonths, negativeMonths, streak, longestStreak int
+
+	// Calculate totals
+	for _, h := range historical {
+		histIncome += h.Income
+		histExpense += h.Expense
+		histNetFlow += h.NetFlow
+
+		streak++
+		switch {
+		case h.NetFlow > 0:
+			positiveMonths++
+			streak = 0
+		case h.NetFlow < 0:
+			negativeMonths++
+			longestStreak = max(longestStreak, streak)
+		default:
+			streak = 0
+		}
+	}
+
+	for _, p := range predicted {
+		predIncome += p.Income
+		predExpense += p.Expense
+		predNetFlow += p.NetFlow
+	}
+
+	// Determine trends and health
+	growthTrend := trendStable
+	thresholds := fa.Config.Thresholds
+	if predIncome > histIncome*thresholds.GrowthUp {
+		growthTrend = trendUp
+	} else if predIncome < histIncome*thresholds.GrowthDown {
+		growthTrend = trendDown
+	}
+
+	riskLevel := riskMedium
+	if predNetFlow < 0 {
+		riskLevel = riskHigh
+	} else if predNetFlow > histNetFlow*thresholds.LowRisk {
+		riskLevel = riskLow
+	}
+
+	cashFlowHealth := healthNormal
+	avgNetFlow := predNetFlow / float64(len(predicted))
+	if avgNetFlow < 0 {
+		cashFlowHealth = healthAtRisk
+	} else if avgNetFlow > histNetFlow/float64(len(historical))*thresholds.StrongHealth {
+		cashFlowHealth = healthStrong
+	}
+
+	// Generate recommendations. The expense they weigh is income minus the
+	// reported net flow, which the direct net flow mode forecasts apart from
+	// the expense series, so the score agrees with the net flow verdicts.
+	histAvgIncome := histIncome / float64(len(historical))
+	predAvgIncome := predIncome / float64(len(predicted))
+	predAvgExpense := predAvgIncome - avgNetFlow
+	score := riskScore(histAvgIncome, predAvgIncome, predAvgExpense)
+
+	details := []Recommendation{}
+	if recommend {
+		margin := -1.0
+		if predAvgIncome > 0 {
+			margin = (predAvgIncome - predAvgExpense) / predAvgIncome
+		}
+		catalog := fa.Config.ruleCatalog()
+		details = generateRecommendations(fa.Config.RecommendationRules, catalog, ruleMetrics{
+			ruleMetricGrowthTrend:    growthTrend,
+			ruleMetricRiskLevel:      riskLevel,
+			ruleMetricCashFlowHealth: cashFlowHealth,
+			ruleMetricNetFlow:        predNetFlow,
+			ruleMetricAvgNetFlow:     avgNetFlow,
+			ruleMetricRiskScore:      score,
+			ruleMetricMargin:         margin,
+		})
+		rankRecommendations(details, catalog, histAvgIncome, predAvgIncome, predAvgExpense)
+	}
+	recommendations := make([]string, len(details))
+	for i, d := range details {
+		recommendations[i] = d.Text
+	}
+
+	return AnalysisSummary{
+		TotalHistoricalIncome:  math.Round(histIncome*100) / 100,
+		TotalHistoricalExpense: math.Round(histExpense*100) / 100,
+		TotalHistoricalNetFlow: math.Round(histNetFlow*100) / 100,
+		PositiveNetFlowMonths:  positiveMonths,
+		NegativeNetFlowMonths:  negativeMonths,
+		LongestNegativeStreak:  longestStreak,
+		PredictedTotalIncome:   math.Round(predIncome*100) / 100,
+		PredictedTotalExpense:  math.Round(predExpense*100) / 100,
+		PredictedTotalNetFlow:  math.Round(predNetFlow*100) / 100,
+		GrowthTrend:            verdictLabels[growthTrend],
+		GrowthTrendCode:        growthTrend,
+		RiskLevel:              verdictLabels[riskLevel],
+		RiskLevelCode:          riskLevel,
+		RiskScore:              score,
+		CashFlowHealth:         verdictLabels[cashFlowHealth],
+		CashFlowHealthCode:     cashFlowHealth,
+		Recommendations:        recommendations,
+		RecommendationDetails:  details,
+	}
+}
+
+// applyGrowthRates reports the monthly growth rates used by the forecast,
+// compounded to a yearly basis when annualized is set. The forecast itself
+// always works with monthly rates.
+func (fa *FinancialAnalyzer) applyGrowthRates(summary *AnalysisSummary, params forecastParams, annualized bool) {
+	incomeGrowthRate := params.IncomeGrowthRate
+	expenseGrowthRate := params.ExpenseGrowthRate
+	summary.RatePeriod = "monthly"
+
+	if annualized {
+		incomeGrowthRate = annualizeRate(incomeGrowthRate)
+		expenseGrowthRate = annualizeRate(expenseGrowthRate)
+		summary.RatePeriod = "annual"
+	}
+
+	summary.IncomeGrowthRate = math.Round(incomeGrowthRate*10000) / 10000
+	summary.ExpenseGrowthRate = math.Round(expenseGrowthRate*10000) / 10000
+	summary.IncomeGrowthSource = params.IncomeGrowthSource
+	summary.ExpenseGrowthSource = params.ExpenseGrowthSource
+}
+
+// StressShock changes the forecast income and expense by a fraction for a
+// span of forecast months, e.g. -0.30 income for 3 months
+type StressShock struct {
+	Name          string  `json:"name"`
+	IncomeChange  float64 `json:"income_change"`
+	ExpenseChange float64 `json:"expense_change"`
+	// StartMonth is the 1-based forecast month the shock begins in (0 = 1)
+	StartMonth int `json:"start_month"`
+	// Months is how long the shock lasts; 0 means until the end of the forecast
+	Months int `json:"months"`
+}
+
+// predefinedShocks are the standard scenarios every stress test includes
+var predefinedShocks = []StressShock{
+	{Name: "3 ay boyunca %30 gelir kaybı", IncomeChange: -0.30, Months: 3},
+	{Name: "Kalıcı %20 gider artışı", ExpenseChange: 0.20},
+	{Name: "Kalıcı %15 gelir kaybı ve %10 gider artışı", IncomeChange: -0.15, ExpenseChange: 0.10},
+}
+
+// StressRequest is an analysis request plus custom shocks
+type StressRequest struct {
+	AnalysisRequest
+	Shocks []StressShock `json:"shocks"`
+}
+
+// StressResult is the outcome of the forecast under one shock
+type StressResult struct {
+	Shock                 StressShock `json:"shock"`
+	PredictedTotalNetFlow float64     `json:"predicted_total_net_flow"`
+	RiskLevel             string      `json:"risk_level"`
+	RiskLevelCode         string      `json:"risk_level_code"`
+	// RunwayMonths counts the forecast months before the balance turns negative
+	RunwayMonths    int     `json:"runway_months"`
+	RunsOutOfCash   bool    `json:"runs_out_of_cash"`
+	MinBalance      float64 `json:"min_balance"`
+	MinBalanceMonth string  `json:"min_balance_month"`
+}
+
+// StressReport compares the baseline forecast with each stress scenario
+type StressReport struct {
+	OpeningBalance float64        `json:"opening_balance"`
+	Baseline       StressResult   `json:"baseline"`
+	Scenarios      []StressResult `json:"scenarios"`
+}
+
+// validateShock checks that a shock lies inside a forecast of horizon months
+// and cannot drive income or expenses below zero
+func validateShock(s StressShock, horizon int) error {
+	if s.IncomeChange < -1 || s.ExpenseChange < -1 {
+		return fmt.Errorf("shock %q: changes must not be below -1", s.Name)
+	}
+	if s.StartMonth < 0 || s.StartMonth > horizon {
+		return fmt.Errorf("shock %q: start_month must be between 1 and %d", s.Name, horizon)
+	}
+	if s.Months < 0 {
+		return fmt.Errorf("shock %q: months must not be negative", s.Name)
+	}
+	return nil
+}
+
+// applyShock returns a copy of predictions with the shock applied. The net
+// flow moves by the shock's change in income minus expenses, so a direct net
+// flow forecast keeps its own level.
+func applyShock(predictions []FinancialData, s StressShock) []FinancialData {
+	shocked := slices.Clone(predictions)
+	start := max(s.StartMonth, 1) - 1
+	end := len(shocked)
+	if s.Months > 0 {
+		end = min(start+s.Months, end)
+	}
+	for i := start; i < end; i++ {
+		p := &shocked[i]
+		before := p.Income - p.Expense
+		p.Income = math.Round(p.Income*(1+s.IncomeChange)*100) / 100
+		p.Expense = math.Round(p.Expense*(1+s.ExpenseChange)*100) / 100
+		p.NetFlow = math.Round((p.NetFlow+p.Income-p.Expense-before)*100) / 100
+	}
+	return shocked
+}
+
+// stressTest runs the forecast once, exactly as analyze does, and replays it
+// under the predefined and custom shocks. The balance starts from the
+// request's opening balance, or zero when none is given.
+func (fa *FinancialAnalyzer) stressTest(req StressRequest) StressReport {
+	run := fa.runForecast(req.AnalysisRequest)
+	historical, predictions := run.historical, run.predictions
+
+	var opening float64
+	if req.OpeningBalance != nil {
+		opening = *req.OpeningBalance
+	}
+
+	evaluate := func(shock StressShock, predicted []FinancialData) StressResult {
+		summary := fa.generateSummary(historical, predicted, false)
+		outlook := balanceOutlook(projectBalance(opening, historical, predicted, req.CapitalInjection), len(historical))
+
+		return StressResult{
+			Shock:                 shock,
+			PredictedTotalNetFlow: summary.PredictedTotalNetFlow,
+			RiskLevel:             summary.RiskLevel,
+			RiskLevelCode:         summary.RiskLevelCode,
+			RunwayMonths:          outlook.RunwayMonths,
+			RunsOutOfCash:         outlook.RunsOutOfCash,
+			MinBalance:            outlook.MinBalance,
+			MinBalanceMonth:       outlook.MinBalanceMonth,
+		}
+	}
+
+	report := StressReport{
+		OpeningBalance: opening,
+		Baseline:       evaluate(StressShock{Name: "Temel senaryo"}, predictions),
+	}
+	for _, shock := range append(slices.Clone(predefinedShocks), req.Shocks...) {
+		report.Scenarios = append(report.Scenarios, evaluate(shock, applyShock(predictions, shock)))
+	}
+	return report
+}
+
+// analyzeTrend reports the growth rates and direction of the history without
+// running the forecast. The trend label compounds the monthly income growth
+// over the six-month horizon and applies the same thresholds as the summary.
+func (fa *FinancialAnalyzer) analyzeTrend(req AnalysisRequest) TrendReport {
+	historical := windowHistory(req.HistoricalData, req.HistoryWindow)
+	params := fa.forecastParams(historical, req)
+
+	var summary AnalysisSummary
+	fa.applyGrowthRates(&summary, params, req.Annualized)
+
+	growthTrend := trendStable
+	horizonGrowth := math.Pow(1+params.IncomeGrowthRate, forecastHorizon)
+	if horizonGrowth > fa.Config.Thresholds.GrowthUp {
+		growthTrend = trendUp
+	} else if horizonGrowth < fa.Config.Thresholds.GrowthDown {
+		growthTrend = trendDown
+	}
+
+	netFlows := make([]float64, len(historical))
+	var absNetFlow float64
+	for i, h := range historical {
+		netFlows[i] = h.NetFlow
+		absNetFlow += math.Abs(h.NetFlow)
+	}
+	_, slope := linearFit(netFlows)
+
+	// A slope under 1% of the average net flow size counts as flat
+	direction := "Yatay"
+	if len(historical) > 0 && math.Abs(slope) >= 0.01*absNetFlow/float64(len(historical)) {
+		direction = "Artıyor"
+		if slope < 0 {
+			direction = "Azalıyor"
+		}
+	}
+
+	return TrendReport{
+		IncomeGrowthRate:  summary.IncomeGrowthRate,
+		ExpenseGrowthRate: summary.ExpenseGrowthRate,
+		RatePeriod:        summary.RatePeriod,
+		GrowthTrend:       verdictLabels[growthTrend],
+		GrowthTrendCode:   growthTrend,
+		NetFlowDirection:  direction,
+		NetFlowSlope:      math.Round(slope*100) / 100,
+	}
+}
+
+// compareToBenchmark compares the historical net margin and income growth rate
+// against the sector's benchmark range. Returns nil for unknown sectors.
+func (fa *FinancialAnalyzer) compareToBenchmark(sector string, historical []FinancialData, opts growthOptions, annualized bool) *BenchmarkComparison {
+	benchmark, ok := fa.Config.SectorBenchmarks[sector]
+	if !ok {
+		return nil
+	}
+
+	var income, netFlow float64
+	for _, h := range historical {
+		income += h.Income
+		netFlow += h.NetFlow
+	}
+
+	var margin float64
+	if income > 0 {
+		margin = netFlow / income
+	}
+
+	growthRate := fa.calculateGrowthRate(historical, "income", opts)
+	growthLow, growthHigh := benchmark.GrowthLow, benchmark.GrowthHigh
+	if annualized {
+		growthRate = annualizeRate(growthRate)
+		growthLow = annualizeRate(growthLow)
+		growthHigh = annualizeRate(growthHigh)
+	}
+
+	return &BenchmarkComparison{
+		Sector:         sector,
+		Margin:         math.Round(margin*10000) / 10000,
+		MarginLow:      benchmark.MarginLow,
+		MarginHigh:     benchmark.MarginHigh,
+		MarginPosition: benchmarkPosition(margin, benchmark.MarginLow, benchmark.MarginHigh),
+		GrowthRate:     math.Round(growthRate*10000) / 10000,
+		GrowthLow:      math.Round(growthLow*10000) / 10000,
+		GrowthHigh:     math.Round(growthHigh*10000) / 10000,
+		GrowthPosition: benchmarkPosition(growthRate, growthLow, growthHigh),
+	}
+}
+
+// benchmarkPosition reports whether value is above, at (within) or below the range
+func benchmarkPosition(value, low, high float64) string {
+	if value > high {
+		return "above"
+	} else if value < low {
+		return "below"
+	}
+	return "at"
+}
+
+// riskScore rates the forecast from 0 (safe) to 100 (critical). A break-even
+// forecast with flat income scores 50; every point of predicted net margin
+// lowers the score by one, and every point of average income growth over
+// the history lowers it by half a point.
+func riskScore(histAvgIncome, predAvgIncome, predAvgExpense float64) float64 {
+	margin := -1.0
+	if predAvgIncome > 0 {
+		margin = (predAvgIncome - predAvgExpense) / predAvgIncome
+	}
+	incomeChange := 0.0
+	if histAvgIncome > 0 {
+		incomeChange = predAvgIncome/histAvgIncome - 1
+	}
+
+	score := 50 - 100*margin - 50*incomeChange
+	return math.Round(math.Max(0, math.Min(score, 100))*10) / 10
+}
+
+// rankRecommendations estimates how far each recommendation would lower the
+// risk score if its lever were applied to the forecast averages, then sorts
+// them by that improvement. Equal improvements keep their original order.
+func rankRecommendations(recs []Recommendation, catalog map[string]recommendationDef, histAvgIncome, predAvgIncome, predAvgExpense float64) {
+	base := riskScore(histAvgIncome, predAvgIncome, predAvgExpense)
+	for i := range recs {
+		def := catalog[recs[i].Code]
+		after := riskScore(histAvgIncome, predAvgIncome*(1+def.IncomeLever), predAvgExpense*(1+def.ExpenseLever))
+		recs[i].ScoreImprovement = math.Round((base-after)*10) / 10
+	}
+	slices.SortStableFunc(recs, func(a, b Recommendation) int {
+		return cmp.Compare(b.ScoreImprovement, a.ScoreImprovement)
+	})
+}
+
+// annualizeRate compounds a monthly rate to its yearly equivalent
+func annualizeRate(monthly float64) float64 {
+	return math.Pow(1+monthly, 12) - 1
+}
+
+// Verdict codes are the stable, locale-independent values of the summary
+// verdicts; clients should switch on these rather than the display labels
+const (
+	trendUp     = "UP"
+	trendStable = "STABLE"
+	trendDown   = "DOWN"
+
+	riskLow    = "LOW"
+	riskMedium = "MEDIUM"
+	riskHigh   = "HIGH"
+
+	healthStrong = "STRONG"
+	healthNormal = "NORMAL"
+	healthAtRisk = "AT_RISK"
+
+	momentumAccelerating = "ACCELERATING"
+	momentumSteady       = "STEADY"
+	momentumDecelerating = "DECELERATING"
+
+	phaseGrowth  = "GROWTH"
+	phasePlateau = "PLATEAU"
+	phaseMature  = "MATURE"
+	phaseDecline = "DECLINE"
+)
+
+// verdictLabels maps each verdict code to its Turkish display label
+var verdictLabels = map[string]string{
+	trendUp:      "Yükseliş",
+	trendStable:  "Stabil",
+	trendDown:    "Düşüş",
+	riskLow:      "Düşük",
+	riskMedium:   "Orta",
+	riskHigh:     "Yüksek",
+	healthStrong: "Güçlü",
+	healthNormal: "Normal",
+	healthAtRisk: "Risk",
+
+	momentumAccelerating: "Hızlanıyor",
+	momentumSteady:       "Sabit",
+	momentumDecelerating: "Yavaşlıyor",
+
+	phaseGrowth:  "Büyüme",
+	phasePlateau: "Durağan",
+	phaseMature:  "Olgunluk",
+	phaseDecline: "Gerileme",
+}
+
+// generateRecommendations evaluates the rules, in order, against the
+// summary's metrics and turns the codes of those that match into advice.
+// Otherwise rules only fire when no other rule matched.
+func generateRecommendations(rules []RecommendationRule, catalog map[string]recommendationDef, metrics ruleMetrics) []Recommendation {
+	var codes, fallback []string
+	for _, rule := range rules {
+		if !rule.matches(metrics) {
+			continue
+		}
+		if rule.Otherwise {
+			fallback = append(fallback, rule.Code)
+		} else {
+			codes = append(codes, rule.Code)
+		}
+	}
+	if len(codes) == 0 {
+		codes = fallback
+	}
+
+	var recommendations []Recommendation
+	for _, code := range resolveRecommendations(codes, catalog) {
+		def := catalog[code]
+		recommendations = append(recommendations, Recommendation{Code: code, Text: def.Text, Category: def.Category, Severity: def.Priority})
+	}
+
+	return recommendations
+}
+
+// Metrics recommendation rules can test. The verdicts are compared as their
+// codes (e.g. HIGH, DOWN); the others are numbers over the forecast.
+const (
+	ruleMetricGrowthTrend    = "growth_trend"
+	ruleMetricRiskLevel      = "risk_level"
+	ruleMetricCashFlowHealth = "cash_flow_health"
+	ruleMetricNetFlow        = "predicted_net_flow"
+	ruleMetricAvgNetFlow     = "avg_predicted_net_flow"
+	ruleMetricRiskScore      = "risk_score"
+	ruleMetricMargin         = "predicted_margin"
+)
+
+// ruleMetricCodes lists the accepted values of each verdict metric; the
+// metrics not in it are numeric
+var ruleMetricCodes = map[string][]string{
+	ruleMetricGrowthTrend:    {trendUp, trendStable, trendDown},
+	ruleMetricRiskLevel:      {riskLow, riskMedium, riskHigh},
+	ruleMetricCashFlowHealth: {healthStrong, healthNormal, healthAtRisk},
+}
+
+// numericRuleMetrics lists the metrics compared as numbers
+var numericRuleMetrics = []string{ruleMetricNetFlow, ruleMetricAvgNetFlow, ruleMetricRiskScore, ruleMetricMargin}
+
+// ruleMetrics holds a summary's value of every rule metric, a string for the
+// verdicts and a float64 for the rest
+type ruleMetrics map[string]any
+
+// Comparison operators of a RuleCondition; verdicts only take eq and ne
+const (
+	ruleOpEq  = "eq"
+	ruleOpNe  = "ne"
+	ruleOpGt  = "gt"
+	ruleOpGte = "gte"
+	ruleOpLt  = "lt"
+	ruleOpLte = "lte"
+)
+
+// RuleCondition compares one metric of the summary with a value
+type RuleCondition struct {
+	Metric string `json:"metric"`
+	Op     string `json:"op"`
+	// Value is a verdict code for the verdict metrics and a number otherwise
+	Value any `json:"value"`
+}
+
+// holds reports whether the condition is true for metrics
+func (c RuleCondition) holds(metrics ruleMetrics) bool {
+	if code, ok := metrics[c.Metric].(string); ok {
+		return (code == c.Value) == (c.Op == ruleOpEq)
+	}
+
+	n, _ := metrics[c.Metric].(float64)
+	v, _ := c.Value.(float64)
+	switch c.Op {
+	case ruleOpEq:
+		return n == v
+	case ruleOpNe:
+		return n != v
+	case ruleOpGt:
+		return n > v
+	case ruleOpGte:
+		return n >= v
+	case ruleOpLt:
+		return n < v
+	default:
+		return n <= v
+	}
+}
+
+// RecommendationRule gives the advice Code when all its conditions hold.
+// Severity, 0 to keep the catalog's, ranks the advice when defensive and
+// expansive recommendations conflict. Text, AdvisoryText, Category and
+// Stance override the catalog entry, and define the advice of a code the
+// catalog does not know.
+type RecommendationRule struct {
+	When []RuleCondition `json:"when,omitempty"`
+	// Otherwise marks a fallback that only applies when no other rule matched
+	Otherwise    bool   `json:"otherwise,omitempty"`
+	Code         string `json:"code"`
+	Severity     int    `json:"severity,omitempty"`
+	Text         string `json:"text,omitempty"`
+	AdvisoryText string `json:"advisory_text,omitempty"`
+	Category     string `json:"category,omitempty"`
+	Stance       string `json:"stance,omitempty"`
+}
+
+// matches reports whether every condition of the rule holds
+func (r RecommendationRule) matches(metrics ruleMetrics) bool {
+	for _, c := range r.When {
+		if !c.holds(metrics) {
+			return false
+		}
+	}
+	return true
+}
+
+// condition is a shorthand for the built-in rules
+func condition(metric, op string, value any) []RuleCondition {
+	return []RuleCondition{{Metric: metric, Op: op, Value: value}}
+}
+
+// defaultRecommendationRules is the built-in rule set: defensive advice for
+// a high risk, growth advice for a falling trend, expansive advice for
+// strong cash flow, profit sharing for a positive net flow, and otherwise
+// keeping up the current performance
+var defaultRecommendationRules = []RecommendationRule{
+	{When: condition(ruleMetricRiskLevel, ruleOpEq, riskHigh), Code: "cash_flow_plan"},
+	{When: condition(ruleMetricRiskLevel, ruleOpEq, riskHigh), Code: "cut_expenses"},
+	{When: condition(ruleMetricRiskLevel, ruleOpEq, riskHigh), Code: "alternative_financing"},
+	{When: condition(ruleMetricGrowthTrend, ruleOpEq, trendDown), Code: "new_marketing"},
+	{When: condition(ruleMetricGrowthTrend, ruleOpEq, trendDown), Code: "cost_optimization"},
+	{When: condition(ruleMetricGrowthTrend, ruleOpEq, trendDown), Code: "review_portfolio"},
+	{When: condition(ruleMetricCashFlowHealth, ruleOpEq, healthStrong), Code: "evaluate_investments"},
+	{When: condition(ruleMetricCashFlowHealth, ruleOpEq, healthStrong), Code: "plan_growth"},
+	{When: condition(ruleMetricCashFlowHealth, ruleOpEq, healthStrong), Code: "emergency_fund"},
+	{When: condition(ruleMetricNetFlow, ruleOpGt, 0.0), Code: "profit_sharing"},
+	{Otherwise: true, Code: "maintain_performance"},
+}
+
+// validateRecommendationRules checks a configured rule set: known metrics
+// and operators, values of the metric's kind, and advice text, category and
+// stance for every code
+func validateRecommendationRules(rules []RecommendationRule) error {
+	for i, rule := range rules {
+		if rule.Code == "" {
+			return fmt.Errorf("recommendation_rules[%d]: code is required", i)
+		}
+		if _, known := recommendationCatalog[rule.Code]; !known && rule.Text == "" {
+			return fmt.Errorf("recommendation_rules[%d]: code %q is not built in and needs a text", i, rule.Code)
+		}
+		if rule.Severity < 0 {
+			return fmt.Errorf("recommendation_rules[%d]: severity must not be negative", i)
+		}
+		if rule.Category != "" && !slices.Contains(recommendationCategories, rule.Category) {
+			return fmt.Errorf("recommendation_rules[%d]: category must be one of %s", i, strings.Join(recommendationCategories, ", "))
+		}
+		if rule.Stance != "" && rule.Stance != stanceDefensive && rule.Stance != stanceExpansive && rule.Stance != stanceNeutral {
+			return fmt.Errorf("recommendation_rules[%d]: stance must be %s, %s or %s", i, stanceDefensive, stanceExpansive, stanceNeutral)
+		}
+
+		for j, c := range rule.When {
+			field := fmt.Sprintf("recommendation_rules[%d].when[%d]", i, j)
+			if codes, verdict := ruleMetricCodes[c.Metric]; verdict {
+				if c.Op != ruleOpEq && c.Op != ruleOpNe {
+					return fmt.Errorf("%s: %s only takes %s or %s", field, c.Metric, ruleOpEq, ruleOpNe)
+				}
+				if code, ok := c.Value.(string); !ok || !slices.Contains(codes, code) {
+					return fmt.Errorf("%s: value must be one of %s", field, strings.Join(codes, ", "))
+				}
+				continue
+			}
+			if !slices.Contains(numericRuleMetrics, c.Metric) {
+				return fmt.Errorf("%s: unknown metric %q", field, c.Metric)
+			}
+			if !slices.Contains([]string{ruleOpEq, ruleOpNe, ruleOpGt, ruleOpGte, ruleOpLt, ruleOpLte}, c.Op) {
+				return fmt.Errorf("%s: unknown op %q", field, c.Op)
+			}
+			if _, ok := c.Value.(float64); !ok {
+				return fmt.Errorf("%s: value must be a number", field)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleCatalog returns the built-in catalog with the rules'
+// severities and advice overrides applied. A code given several severities
+// keeps the highest.
+func (c AnalyzerConfig) ruleCatalog() map[string]recommendationDef {
+	catalog := maps.Clone(recommendationCatalog)
+	severities := make(map[string]int)
+	for _, rule := range c.RecommendationRules {
+		def, known := catalog[rule.Code]
+		if !known {
+			def = recommendationDef{Stance: stanceNeutral, Category: categoryGrowth}
+		}
+		if rule.Severity > 0 {
+			severities[rule.Code] = max(severities[rule.Code], rule.Severity)
+			def.Priority = severities[rule.Code]
+		}
+		if rule.Text != "" {
+			def.Text = rule.Text
+			def.AdvisoryText = rule.Text
+		}
+		if rule.AdvisoryText != "" {
+			def.AdvisoryText = rule.AdvisoryText
+		}
+		if rule.Category != "" {
+			def.Category = rule.Category
+		}
+		if rule.Stance != "" {
+			def.Stance = rule.Stance
+		}
+		catalog[rule.Code] = def
+	}
+	return catalog
+}
+
+// Recommendation is one piece of advice with its code and category
+type Recommendation struct {
+	Code     string `json:"code"`
+	Text     string `json:"text"`
+	Category string `json:"category"`
+	// Severity ranks the advice; defensive and expansive advice conflict,
+	// the stance with the most severe recommendation wins
+	Severity int `json:"severity"`
+	// ScoreImprovement is how many points the risk score is expected to drop
+	ScoreImprovement float64 `json:"score_improvement"`
+}
+
+// Recommendation tones selected with AnalysisRequest.Tone
+const (
+	toneDirect   = "direct"
+	toneAdvisory = "advisory"
+)
+
+// applyTone rewrites the summary's recommendation texts in the given tone.
+// The direct tone, the default, keeps the texts as generated.
+func applyTone(summary *AnalysisSummary, catalog map[string]recommendationDef, tone string) {
+	if tone != toneAdvisory {
+		return
+	}
+	for i, d := range summary.RecommendationDetails {
+		text := catalog[d.Code].AdvisoryText
+		summary.RecommendationDetails[i].Text = text
+		summary.Recommendations[i] = text
+	}
+}
+
+// Recommendation categories selectable with ?recommendation_categories=
+const (
+	categoryCost       = "cost"
+	categoryGrowth     = "growth"
+	categoryLiquidity  = "liquidity"
+	categoryInvestment = "investment"
+)
+
+// recommendationCategories lists the accepted recommendation categories
+var recommendationCategories = []string{categoryCost, categoryGrowth, categoryLiquidity, categoryInvestment}
+
+// filterRecommendations returns summary with only the recommendations in categories
+func filterRecommendations(summary AnalysisSummary, categories []string) AnalysisSummary {
+	summary.Recommendations = []string{}
+	details := summary.RecommendationDetails
+	summary.RecommendationDetails = []Recommendation{}
+	for _, d := range details {
+		if slices.Contains(categories, d.Category) {
+			summary.Recommendations = append(summary.Recommendations, d.Text)
+			summary.RecommendationDetails = append(summary.RecommendationDetails, d)
+		}
+	}
+	return summary
+}
+
+// Recommendation stances; defensive and expansive advice contradict each other
+const (
+	stanceDefensive = "defensive"
+	stanceExpansive = "expansive"
+	stanceNeutral   = "neutral"
+)
+
+// recommendationDef describes one recommendation code. Text is the direct
+// phrasing and AdvisoryText the softer one. IncomeLever and ExpenseLever are
+// the assumed fractional change in average predicted income and expense if
+// the advice is followed, used to rank it.
+type recommendationDef struct {
+	Text         string
+	AdvisoryText string
+	Priority     int
+	Stance       string
+	Category     string
+	IncomeLever  float64
+	ExpenseLever float64
+}
+
+// recommendationCatalog holds every recommendation the analyzer can give
+var recommendationCatalog = map[string]recommendationDef{
+	"cash_flow_plan":        {"Acil nakit akış planı oluşturun", "Yakın dönem için bir nakit akış planı hazırlamanız faydalı olabilir", 100, stanceDefensive, categoryLiquidity, 0, -0.03},
+	"cut_expenses":          {"Gereksiz giderleri kısmayı düşünün", "Gerekli olmayan gider kalemlerini azaltmayı değerlendirebilirsiniz", 90, stanceDefensive, categoryCost, 0, -0.10},
+	"alternative_financing": {"Alternatif finansman kaynaklarını araştırın", "Alternatif finansman seçeneklerini incelemeniz yararlı olabilir", 80, stanceDefensive, categoryLiquidity, 0, 0},
+	"cost_optimization":     {"Maliyet optimizasyonu yapın", "Maliyet yapınızdaki iyileştirme fırsatlarını değerlendirebilirsiniz", 70, stanceDefensive, categoryCost, 0, -0.05},
+	"new_marketing":         {"Yeni pazarlama stratejileri geliştirin", "Yeni pazarlama yaklaşımlarını değerlendirmeniz faydalı olabilir", 60, stanceNeutral, categoryGrowth, 0.05, 0.01},
+	"review_portfolio":      {"Ürün/hizmet portföyünüzü gözden geçirin", "Ürün/hizmet portföyünüzü gözden geçirmeyi düşünebilirsiniz", 55, stanceNeutral, categoryGrowth, 0.03, 0},
+	"evaluate_investments":  {"Yatırım fırsatlarını değerlendirin", "Uygun yatırım fırsatlarını değerlendirmeyi düşünebilirsiniz", 50, stanceExpansive, categoryInvestment, 0.04, 0.02},
+	"plan_growth":           {"Büyüme stratejileri planlayın", "Büyüme stratejileri üzerine plan yapmanız yararlı olabilir", 45, stanceExpansive, categoryGrowth, 0.03, 0.01},
+	"emergency_fund":        {"Acil durum fonu oluşturun", "Bir acil durum fonu oluşturmayı değerlendirebilirsiniz", 40, stanceExpansive, categoryLiquidity, 0, 0},
+	"profit_sharing":        {"Kâr paylaşım planı düşünün", "Bir kâr paylaşım planı düşünebilirsiniz", 30, stanceExpansive, categoryInvestment, 0, 0},
+	"maintain_performance":  {"Mevcut performansınızı korumaya odaklanın", "Mevcut performansınızı korumaya odaklanmanız önerilir", 10, stanceNeutral, categoryGrowth, 0, 0},
+}
+
+// resolveRecommendations drops duplicate codes and, when defensive and
+// expansive advice are both present, keeps only the stance holding the
+// highest-priority recommendation. The original order is preserved.
+func resolveRecommendations(codes []string, catalog map[string]recommendationDef) []string {
+	seen := make(map[string]bool)
+	topPriority := make(map[string]int)
+	var unique []string
+
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		unique = append(unique, code)
+
+		def := catalog[code]
+		topPriority[def.Stance] = max(topPriority[def.Stance], def.Priority)
+	}
+
+	dropped := ""
+	if topPriority[stanceDefensive] > 0 && topPriority[stanceExpansive] > 0 {
+		dropped = stanceExpansive
+		if topPriority[stanceExpansive] > topPriority[stanceDefensive] {
+			dropped = stanceDefensive
+		}
+	}
+
+	return slices.DeleteFunc(unique, func(code string) bool {
+		return catalog[code].Stance == dropped
+	})
+}
+
+// APIError is the structured error body returned by the API
+type APIError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	// Violations lists every schema violation when Error is schema_violation
+	Violations []SchemaViolation `json:"violations,omitempty"`
+}
+
+// writeAPIError writes apiErr as a JSON response with the given status
+func writeAPIError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// unknownFieldName extracts the field name from the error json.Decoder
+// returns when DisallowUnknownFields rejects a field
+func unknownFieldName(err error) (string, bool) {
+	const prefix = "json: unknown field "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return "", false
+	}
+	return strings.Trim(strings.TrimPrefix(msg, prefix), `"`), true
+}
+
+// SchemaViolation is one place where a payload does not match its schema
+type SchemaViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// jsonSchema is the subset of JSON Schema the API uses to describe and
+// validate request bodies
+type jsonSchema struct {
+	Schema     string                 `json:"$schema,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*jsonSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *jsonSchema            `json:"items,omitempty"`
+	Enum       []string               `json:"enum,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+	// ExclusiveMinimum is a lower bound the value must lie strictly above
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	MinItems         int      `json:"minItems,omitempty"`
+}
+
+// floatPtr returns a pointer to v for optional schema bounds
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// financialDataSchema describes one month of FinancialData
+var financialDataSchema = &jsonSchema{
+	Type:     "object",
+	Required: []string{"month", "income", "expense"},
+	Properties: map[string]*jsonSchema{
+		"month":         {Type: "string"},
+		"income":        {Type: "number"},
+		"expense":       {Type: "number"},
+		"net_flow":      {Type: "number"},
+		"currency":      {Type: "string"},
+		"days_elapsed":  {Type: "integer", Minimum: floatPtr(1)},
+		"days_in_month": {Type: "integer", Minimum: floatPtr(28), Maximum: floatPtr(31)},
+	},
+}
+
+// analysisRequestSchema is the JSON Schema of AnalysisRequest; it is served
+// at /api/schema and checked before a payload is decoded
+var analysisRequestSchema = &jsonSchema{
+	Schema:   "https://json-schema.org/draft/2020-12/schema",
+	Title:    "AnalysisRequest",
+	Type:     "object",
+	Required: []string{"historical_data"},
+	Properties: map[string]*jsonSchema{
+		"schema_version": {Type: "integer", Minimum: floatPtr(1)},
+		"company": {
+			Type: "object",
+			Properties: map[string]*jsonSchema{
+				"id":                      {Type: "string"},
+				"name":                    {Type: "string"},
+				"sector":                  {Type: "string"},
+				"monthly_avg_income":      {Type: "number"},
+				"monthly_avg_expense":     {Type: "number"},
+				"fiscal_year_start_month": {Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(12)},
+				"employee_count":          {Type: "integer", Minimum: floatPtr(1)},
+				"currency":                {Type: "string"},
+			},
+		},
+		"historical_data":      {Type: "array", MinItems: 1, Items: financialDataSchema},
+		"annualized":           {Type: "boolean"},
+		"history_window":       {Type: "integer", Minimum: floatPtr(0)},
+		"include_full_history": {Type: "boolean"},
+		"events": {
+			Type: "array",
+			Items: &jsonSchema{
+				Type:     "object",
+				Required: []string{"month"},
+				Properties: map[string]*jsonSchema{
+					"month":         {Type: "string"},
+					"income_delta":  {Type: "number"},
+					"expense_delta": {Type: "number"},
+				},
+			},
+		},
+		"budget": {
+			Type: "array",
+			Items: &jsonSchema{
+				Type:     "object",
+				Required: []string{"month", "income", "expense"},
+				Properties: map[string]*jsonSchema{
+					"month":   {Type: "string"},
+					"income":  {Type: "number"},
+					"expense": {Type: "number"},
+				},
+			},
+		},
+		"model":               {Type: "string", Enum: supportedModels},
+		"income_model":        {Type: "string", Enum: supportedModels},
+		"expense_model":       {Type: "string", Enum: supportedModels},
+		"growth_method":       {Type: "string", Enum: supportedGrowthMethods},
+		"zero_income_policy":  {Type: "string", Enum: []string{zeroIncomeInclude, zeroIncomeExclude}},
+		"seasonally_adjusted": {Type: "boolean"},
+		"trust_net_flow":      {Type: "boolean"},
+		"opening_balance":     {Type: "number"},
+		"capital_injection": {
+			Type:     "object",
+			Required: []string{"month", "amount"},
+			Properties: map[string]*jsonSchema{
+				"month":  {Type: "string"},
+				"amount": {Type: "number", ExclusiveMinimum: floatPtr(0)},
+			},
+		},
+		"decomposition_mode":      {Type: "string", Enum: []string{decomposeMultiplicative, decomposeAdditive}},
+		"net_flow_mode":           {Type: "string", Enum: []string{netFlowComponents, netFlowDirect}},
+		"order":                   {Type: "string", Enum: []string{orderAsc, orderDesc}},
+		"simulations":             {Type: "integer", Minimum: floatPtr(0), Maximum: floatPtr(maxSimulations)},
+		"tone":                    {Type: "string", Enum: []string{toneDirect, toneAdvisory}},
+		"income_ceiling":          {Type: "number", Minimum: floatPtr(0)},
+		"skip_growth_periods":     {Type: "integer", Minimum: floatPtr(0)},
+		"deltas":                  {Type: "boolean"},
+		"forecast_until":          {Type: "string"},
+		"expense_cap_ratio":       {Type: "number", Minimum: floatPtr(0)},
+		"skip_recommendations":    {Type: "boolean"},
+		"model_params":            {Type: "object"},
+		"fan_levels":              {Type: "array", Items: &jsonSchema{Type: "number", Minimum: floatPtr(0), Maximum: floatPtr(1)}},
+		"income_growth_override":  {Type: "number", Minimum: floatPtr(-1)},
+		"expense_growth_override": {Type: "number", Minimum: floatPtr(-1)},
+		"reinvestment_rate":       {Type: "number", Minimum: floatPtr(0), Maximum: floatPtr(1)},
+	},
+}
+
+// validate checks v, decoded with json.Decoder.UseNumber, against s and
+// returns every violation found. A null value is treated like an absent one,
+// matching how encoding/json decodes it.
+func (s *jsonSchema) validate(field string, v interface{}) []SchemaViolation {
+	if v == nil {
+		return nil
+	}
+
+	violation := func(format string, args ...interface{}) []SchemaViolation {
+		name := field
+		if name == "" {
+			name = "(root)"
+		}
+		return []SchemaViolation{{Field: name, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	var violations []SchemaViolation
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return violation("must be an object")
+		}
+		for _, name := range s.Required {
+			if obj[name] == nil {
+				violations = append(violations, SchemaViolation{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+			violations = append(violations, s.Properties[name].validate(joinField(field, name), obj[name])...)
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return violation("must be an array")
+		}
+		if len(arr) < s.MinItems {
+			violations = append(violations, violation("must contain at least %d item(s)", s.MinItems)...)
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				violations = append(violations, s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item)...)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return violation("must be a string")
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			violations = append(violations, violation("must be one of %s", strings.Join(s.Enum, ", "))...)
+		}
+	case "number", "integer":
+		num, ok := v.(json.Number)
+		if !ok {
+			return violation("must be a %s", s.Type)
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return violation("must be an integer")
+			}
+		}
+		n, err := num.Float64()
+		if err != nil {
+			return violation("must be a valid number")
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			violations = append(violations, violation("must be at least %v", *s.Minimum)...)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			violations = append(violations, violation("must be at most %v", *s.Maximum)...)
+		}
+		if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+			violations = append(violations, violation("must be greater than %v", *s.ExclusiveMinimum)...)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return violation("must be a boolean")
+		}
+	}
+
+	return violations
+}
+
+// normalizeNumbers returns v with every string found where s expects a number
+// parsed by parseLocaleNumber, so spreadsheet values like "1.234.567,89" decode
+// as numbers. Strings that do not parse are reported as violations.
+func (s *jsonSchema) normalizeNumbers(field string, v interface{}) (interface{}, []SchemaViolation) {
+	var violations []SchemaViolation
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range slices.Sorted(maps.Keys(s.Properties)) {
+			if value[name] == nil {
+				continue
+			}
+			normalized, childViolations := s.Properties[name].normalizeNumbers(joinField(field, name), value[name])
+			value[name] = normalized
+			violations = append(violations, childViolations...)
+		}
+	case []interface{}:
+		if s.Items == nil {
+			break
+		}
+		for i, item := range value {
+			normalized, itemViolations := s.Items.normalizeNumbers(fmt.Sprintf("%s[%d]", field, i), item)
+			value[i] = normalized
+			violations = append(violations, itemViolations...)
+		}
+	case string:
+		if s.Type != "number" && s.Type != "integer" {
+			break
+		}
+		n, err := parseLocaleNumber(value)
+		if err != nil {
+			return v, []SchemaViolation{{Field: field, Message: fmt.Sprintf("cannot parse %q as a number", value)}}
+		}
+		return json.Number(strconv.FormatFloat(n, 'f', -1, 64)), nil
+	}
+	return v, violations
+}
+
+// parseLocaleNumber parses a number written with thousands and decimal
+// separators. When both "." and "," appear the last one is the decimal
+// separator. A lone separator follows Turkish usage: a single "," is
+// decimal, while "." is a thousands separator when repeated or followed by
+// exactly three digits. Spaces and a ₺/TL currency marker are ignored.
+func parseLocaleNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "₺"), "TL")
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if comma > dot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case comma >= 0:
+		if strings.Count(s, ",") > 1 {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case dot >= 0:
+		if strings.Count(s, ".") > 1 || len(s)-dot-1 == 3 {
+			s = strings.ReplaceAll(s, ".", "")
+		}
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// missingNetFlows reports the historical months of a raw, schema-valid
+// payload that carry no net_flow value
+func missingNetFlows(payload interface{}) []SchemaViolation {
+	obj, _ := payload.(map[string]interface{})
+	history, _ := obj["historical_data"].([]interface{})
+
+	var violations []SchemaViolation
+	for i, entry := range history {
+		month, _ := entry.(map[string]interface{})
+		if month["net_flow"] == nil {
+			violations = append(violations, SchemaViolation{
+				Field:   fmt.Sprintf("historical_data[%d].net_flow", i),
+				Message: "is required when trust_net_flow is set",
+			})
+		}
+	}
+	return violations
+}
+
+// nonFiniteValues reports the historical values of a raw payload that do not
+// fit a finite float64, such as 1e400. encoding/json would refuse them with a
+// generic error; naming the field and month makes the rejection actionable.
+func nonFiniteValues(payload interface{}) []SchemaViolation {
+	obj, _ := payload.(map[string]interface{})
+	history, _ := obj["historical_data"].([]interface{})
+
+	var violations []SchemaViolation
+	for i, entry := range history {
+		month, _ := entry.(map[string]interface{})
+		name, _ := month["month"].(string)
+		for _, field := range []string{"income", "expense", "net_flow"} {
+			num, ok := month[field].(json.Number)
+			if !ok {
+				continue
+			}
+			if v, _ := strconv.ParseFloat(string(num), 64); math.IsInf(v, 0) || math.IsNaN(v) {
+				violations = append(violations, SchemaViolation{
+					Field:   fmt.Sprintf("historical_data[%d].%s", i, field),
+					Message: fmt.Sprintf("%s for month %q is not a finite number", num, name),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// nonFiniteError is the 422 body for payloads with non-finite values
+func nonFiniteError(violations []SchemaViolation) APIError {
+	return APIError{
+		Error:      "non_finite_number",
+		Message:    "Historical values must be finite numbers",
+		Field:      violations[0].Field,
+		Violations: violations,
+	}
+}
+
+// joinField appends name to the dotted field path parent
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// maxBodyBytes caps the size of request bodies; main sets it from the config
+var maxBodyBytes int64 = 1 << 20
+
+// maxBatchBytes caps the size of streamed batch bodies; main sets it from
+// the config
+var maxBatchBytes int64 = 64 << 20
+
+// bodyLimit returns the body size limit of a request
+type bodyLimit func(r *http.Request) int64
+
+// defaultBodyLimit applies maxBodyBytes to every request
+func defaultBodyLimit(*http.Request) int64 {
+	return maxBodyBytes
+}
+
+// batchBodyLimit allows maxBatchBytes only to batches streamed as NDJSON,
+// which decode one request at a time; a plain JSON batch is decoded and
+// answered as a whole, so it keeps maxBodyBytes
+func batchBodyLimit(r *http.Request) int64 {
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		return maxBatchBytes
+	}
+	return maxBodyBytes
+}
+
+// limitBody rejects bodies larger than limit(r) with 413. A declared
+// Content-Length over the limit is refused before anything is read and the
+// connection is closed, so the unread upload cannot confuse a following
+// request. Chunked bodies are cut off by http.MaxBytesReader mid-read, which
+// also makes the server close the connection; handlers report that case
+// through writeDecodeError.
+func limitBody(limit bodyLimit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		max := limit(r)
+		if r.ContentLength > max {
+			w.Header().Set("Connection", "close")
+			writeBodyTooLarge(w, max)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next(w, r)
+	}
+}
+
+// writeBodyTooLarge writes the structured 413 response
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	writeAPIError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(limit))
+}
+
+// bodyTooLargeError is the error body of a request over limit bytes
+func bodyTooLargeError(limit int64) APIError {
+	return APIError{
+		Error:   "request_too_large",
+		Message: fmt.Sprintf("Request body exceeds the limit of %d bytes", limit),
+	}
+}
+
+// writeDecodeError reports a failure to read or decode a request body: 413
+// when the body hit the size limit, 400 otherwise
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeBodyTooLarge(w, tooLarge.Limit)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+}
+
+// basePath is the prefix every route is mounted under, set from BASE_PATH
+var basePath string
+
+// normalizeBasePath turns a BASE_PATH value like "finance/" into "/finance";
+// empty and "/" mean the service is served from the root
+func normalizeBasePath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// route registers handler for basePath+pattern on the default mux. Requests with a
+// method outside methods get 405 with the matching Allow header, and
+// preflights are answered by corsMiddleware for the same methods.
+func route(pattern string, handler http.HandlerFunc, methods ...string) {
+	routeWithLimit(pattern, defaultBodyLimit, handler, methods...)
+}
+
+// registeredRoutes lists the patterns registered by route, without basePath,
+// so /api/capabilities reports only the endpoints that are served
+var registeredRoutes []string
+
+// routeWithLimit is route with its own body size limit
+func routeWithLimit(pattern string, limit bodyLimit, handler http.HandlerFunc, methods ...string) {
+	registeredRoutes = append(registeredRoutes, pattern)
+	http.HandleFunc(basePath+pattern, corsMiddleware(allowMethods(limitBody(limit, handler), methods...), methods...))
+}
+
+// allowMethods rejects requests whose method is not one of methods
+func allowMethods(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(methods, r.Method) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			http.Error(w, "Method not allowed. Use "+strings.Join(methods, " or "), http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// CORS middleware. methods are the methods the wrapped route accepts; a
+// preflight asking for any other method is refused with 405.
+func corsMiddleware(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allowed := strings.Join(append(slices.Clone(methods), http.MethodOptions), ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", allowed)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allowed)
+			requested := r.Header.Get("Access-Control-Request-Method")
+			if requested != "" && !slices.Contains(methods, requested) {
+				http.Error(w, fmt.Sprintf("Method %s not allowed on this route", requested), http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// HTTP Handlers
+func (fa *FinancialAnalyzer) analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("analyze request", "method", r.Method, "path", r.URL.Path)
+
+	analyzer := fa.forRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	// The audit log hashes the body as received, before tolerant_numbers
+	// normalizes it
+	bodySum := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(bodySum[:])
+
+	req, status, apiErr := analyzer.prepareRawRequest(body, prepareOptions{
+		Strict:          r.URL.Query().Get(queryStrict) == "true",
+		TolerantNumbers: r.URL.Query().Get(queryTolerantNumbers) == "true",
+	})
+	if apiErr != nil {
+		writeAPIError(w, status, *apiErr)
+		return
+	}
+
+	format := r.URL.Query().Get(queryFormat)
+	if format != "" && format != formatTidy {
+		http.Error(w, fmt.Sprintf("Unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+	envelope := r.URL.Query().Get("envelope")
+	if envelope != "" && envelope != envelopeGzipBase64 {
+		http.Error(w, fmt.Sprintf("Unsupported envelope %q", envelope), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var categories []string
+	if param := r.URL.Query().Get("recommendation_categories"); param != "" {
+		categories = strings.Split(param, ",")
+		for _, c := range categories {
+			if !slices.Contains(recommendationCategories, c) {
+				http.Error(w, fmt.Sprintf("Unsupported recommendation category %q", c), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// Work on a copy so the stored analysis keeps UTC and every recommendation
+	stored := analyzer.newAnalysis(req)
+	analysis := inOrder(inZone(stored, loc), req.Order)
+	if categories != nil {
+		analysis.Summary = filterRecommendations(analysis.Summary, categories)
+	}
+	if r.URL.Query().Get("explain") == "true" {
+		analysis.Explain = analyzer.explainForecast(req, analysis)
+	}
+
+	etag, err := analysisETag(analysis, format+envelope)
+	if err == nil {
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			// The client already has this analysis: nothing is stored or audited
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	analyzer.saveAnalysis(req, stored)
+	if analyzer.audit != nil {
+		analyzer.audit.Record(analyzer.auditEntry(r, requestHash, analysis))
+	}
+
+	var response interface{} = analysis
+	if format == formatTidy {
+		response = tidyRows(analysis)
+	}
+	if envelope == envelopeGzipBase64 {
+		if response, err = compressedEnvelope(response); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// envelopeGzipBase64 is the envelope query value that returns the response
+// compressed into a single string field
+const envelopeGzipBase64 = "gzip_base64"
+
+// CompressedEnvelope carries a JSON document as gzip compressed, unpadded
+// URL-safe base64 text, compact enough to embed in another document or a URL
+type CompressedEnvelope struct {
+	Encoding string `json:"encoding"`
+	// Size is the length in bytes of the uncompressed JSON
+	Size int    `json:"size"`
+	Data string `json:"data"`
+}
+
+// compressedEnvelope marshals v and wraps it in a CompressedEnvelope
+func compressedEnvelope(v interface{}) (CompressedEnvelope, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return CompressedEnvelope{}, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return CompressedEnvelope{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return CompressedEnvelope{}, err
+	}
+	return CompressedEnvelope{
+		Encoding: envelopeGzipBase64,
+		Size:     len(payload),
+		Data:     base64.RawURLEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// TidyRow is one (company, month, metric) observation in long format
+type TidyRow struct {
+	CompanyID string  `json:"company_id"`
+	Month     string  `json:"month"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Type      string  `json:"type"`
+}
+
+// tidyRows flattens the historical and predicted series of an analysis into
+// one row per month and metric, ready for R/pandas ingestion
+func tidyRows(analysis *FinancialAnalysis) []TidyRow {
+	rows := make([]TidyRow, 0, 3*(len(analysis.HistoricalData)+len(analysis.Predictions)))
+
+	appendSeries := func(data []FinancialData, kind string) {
+		for _, d := range data {
+			for _, m := range []struct {
+				metric string
+				value  float64
+			}{
+				{"income", d.Income},
+				{"expense", d.Expense},
+				{"net_flow", d.NetFlow},
+			} {
+				rows = append(rows, TidyRow{
+					CompanyID: analysis.Company.ID,
+					Month:     d.Month,
+					Metric:    m.metric,
+					Value:     m.value,
+					Type:      kind,
+				})
+			}
+		}
+	}
+
+	appendSeries(analysis.HistoricalData, "historical")
+	appendSeries(analysis.Predictions, "predicted")
+
+	return rows
+}
+
+// seasonalityHandler returns only the seasonal factors for a submitted
+// history, validated like analyze and taken from the same windowed and
+// prorated history the forecast learns from
+func (fa *FinancialAnalyzer) seasonalityHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req, status, apiErr := analyzer.prepareRawRequest(body, prepareOptions{})
+	if apiErr != nil {
+		writeAPIError(w, status, *apiErr)
+		return
+	}
+
+	trendHistory, _ := prorateLatest(windowHistory(req.HistoricalData, req.HistoryWindow))
+	seasonality := analyzer.analyzeSeasonality(trendHistory)
+	if req.SeasonallyAdjusted {
+		seasonality = unappliedSeasonality()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(seasonality); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ndjsonContentType is the Accept value that streams batch results
+const ndjsonContentType = "application/x-ndjson"
+
+// batchWorkers is the size of the worker pool of each batch; main sets it
+// from BATCH_WORKERS or the config
+var batchWorkers = runtime.NumCPU()
+
+// batchQueueDepth counts the batch requests of all running batches that are
+// still waiting for a worker
+var batchQueueDepth atomic.Int64
+
+// BatchRequest analyzes several companies in one call. Requests are kept
+// raw so each is validated on its own and a bad one fails only its result.
+type BatchRequest struct {
+	Requests []json.RawMessage `json:"requests"`
+}
+
+// BatchResult is the outcome of one request of a batch; Index is its
+// position in the submitted requests
+type BatchResult struct {
+	Index     int                `json:"index"`
+	CompanyID string             `json:"company_id,omitempty"`
+	Analysis  *FinancialAnalysis `json:"analysis,omitempty"`
+	Error     *APIError          `json:"error,omitempty"`
+}
+
+// prepareOptions are the switches analyzeHandler reads from its query
+// string; the other endpoints use the zero value
+type prepareOptions struct {
+	// Strict rejects unknown fields instead of ignoring them
+	Strict bool
+	// TolerantNumbers accepts numeric fields sent as strings with separators
+	TolerantNumbers bool
+}
+
+// prepareRawRequest validates and decodes one raw AnalysisRequest, a request
+// body or e.g. an element of a batch. On failure it returns the HTTP status
+// with the structured error.
+func (fa *FinancialAnalyzer) prepareRawRequest(raw json.RawMessage, opts prepareOptions) (AnalysisRequest, int, *APIError) {
+	var req AnalysisRequest
+
+	// Validate the raw payload against the schema so clients get every
+	// violation at once instead of the first decode error
+	var payload interface{}
+	rawDecoder := json.NewDecoder(bytes.NewReader(raw))
+	rawDecoder.UseNumber()
+	if err := rawDecoder.Decode(&payload); err != nil {
+		return req, http.StatusBadRequest, &APIError{Error: "invalid_json", Message: err.Error()}
+	}
+	if opts.TolerantNumbers {
+		normalized, violations := analysisRequestSchema.normalizeNumbers("", payload)
+		if len(violations) > 0 {
+			return req, http.StatusBadRequest, &APIError{
+				Error:      "invalid_number",
+				Message:    "Some numeric strings could not be parsed",
+				Violations: violations,
+			}
+		}
+		payload = normalized
+		var err error
+		if raw, err = json.Marshal(payload); err != nil {
+			return req, http.StatusInternalServerError, &APIError{Error: "internal_error", Message: "Error normalizing request"}
+		}
+	}
+	if violations := nonFiniteValues(payload); len(violations) > 0 {
+		apiErr := nonFiniteError(violations)
+		return req, http.StatusUnprocessableEntity, &apiErr
+	}
+	if violations := analysisRequestSchema.validate("", payload); len(violations) > 0 {
+		return req, http.StatusBadRequest, &APIError{
+			Error:      "schema_violation",
+			Message:    "Request does not match the AnalysisRequest schema",
+			Violations: violations,
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if opts.Strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&req); err != nil {
+		if field, ok := unknownFieldName(err); ok && opts.Strict {
+			return req, http.StatusBadRequest, &APIError{
+				Error:   "unknown_field",
+				Message: fmt.Sprintf("Unknown field %q in request", field),
+				Field:   field,
+			}
+		}
+		return req, http.StatusBadRequest, &APIError{Error: "invalid_json", Message: err.Error()}
+	}
+
+	if req.SchemaVersion != 0 && !slices.Contains(supportedSchemaVersions, req.SchemaVersion) {
+		return req, http.StatusBadRequest, &APIError{
+			Error:   "unsupported_schema_version",
+			Message: fmt.Sprintf("schema_version %d is not supported; supported versions: %v", req.SchemaVersion, supportedSchemaVersions),
+			Field:   "schema_version",
+		}
+	}
+	applySchemaDefaults(&req)
+	stripControlCharacters(&req.Company)
+
+	for i := range req.Events {
+		req.Events[i].Month = fa.canonicalMonth(req.Events[i].Month)
+	}
+	for i := range req.Budget {
+		req.Budget[i].Month = fa.canonicalMonth(req.Budget[i].Month)
+	}
+	if req.CapitalInjection != nil {
+		req.CapitalInjection.Month = fa.canonicalMonth(req.CapitalInjection.Month)
+	}
+	// Events and budgets depend on the current month, which a static schema cannot express
+	if err := fa.Validate(req); err != nil {
+		status, apiErr := analyzerAPIError(err)
+		return req, status, &apiErr
+	}
+
+	if req.TrustNetFlow {
+		if violations := missingNetFlows(payload); len(violations) > 0 {
+			return req, http.StatusBadRequest, &APIError{
+				Error:      "missing_net_flow",
+				Message:    "trust_net_flow requires net_flow on every historical month",
+				Violations: violations,
+			}
+		}
+	} else {
+		// Calculate net flows from income and expense
+		for i := range req.HistoricalData {
+			req.HistoricalData[i].NetFlow = req.HistoricalData[i].Income - req.HistoricalData[i].Expense
+		}
+	}
+	return req, http.StatusOK, nil
+}
+
+// batchSource returns the raw requests of a batch one at a time and io.EOF
+// after the last one
+type batchSource func() (json.RawMessage, error)
+
+// sliceSource is the batchSource of requests already in memory
+func sliceSource(requests []json.RawMessage) batchSource {
+	next := 0
+	return func() (json.RawMessage, error) {
+		if next == len(requests) {
+			return nil, io.EOF
+		}
+		next++
+		return requests[next-1], nil
+	}
+}
+
+// errEmptyBatch is returned by streamSource for a batch without requests
+var errEmptyBatch = errors.New("at least one request is required")
+
+// streamSource reads the "requests" array of a BatchRequest from dec element
+// by element, so only the requests being worked on are held in memory. Keys
+// before "requests" are skipped; anything after it is never read. It fails
+// before returning a source when the array is missing or empty.
+func streamSource(dec *json.Decoder) (batchSource, error) {
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("batch must be a JSON object")
+	}
+	for {
+		if !dec.More() {
+			return nil, errEmptyBatch
+		}
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key == "requests" {
+			break
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('[') {
+		return nil, errors.New("requests must be an array")
+	}
+	if !dec.More() {
+		return nil, errEmptyBatch
+	}
+
+	return func() (json.RawMessage, error) {
+		if !dec.More() {
+			return nil, io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}, nil
+}
+
+// batchJob is one request of a batch, or the error that ended reading them
+type batchJob struct {
+	index int
+	raw   json.RawMessage
+	err   error
+}
+
+// runBatch analyzes the requests of next on a pool of workers and calls emit
+// from the calling goroutine as each result completes, so results arrive in
+// completion order. Requests are read only as workers become free; queued
+// is how many of them are already in memory and count as waiting from the
+// start, the others count once read. A request
+// over max_body_bytes fails on its own; a read error is reported as the
+// result of the index it occurred at and ends the batch. Cancelling ctx, or
+// emit returning an error, stops the remaining work.
+func (fa *FinancialAnalyzer) runBatch(ctx context.Context, next batchSource, queued, workers int, emit func(BatchResult) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batchQueueDepth.Add(int64(queued))
+	jobs := make(chan batchJob)
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			raw, err := next()
+			if err == io.EOF {
+				return
+			}
+			if i >= queued {
+				batchQueueDepth.Add(1)
+			}
+			select {
+			case jobs <- batchJob{index: i, raw: raw, err: err}:
+			case <-ctx.Done():
+				batchQueueDepth.Add(-int64(max(queued-i, 1)))
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for job := range jobs {
+				batchQueueDepth.Add(-1)
+				result := BatchResult{Index: job.index}
+				switch {
+				case job.err != nil:
+					apiErr := APIError{Error: "invalid_json", Message: job.err.Error()}
+					var tooLarge *http.MaxBytesError
+					if errors.As(job.err, &tooLarge) {
+						apiErr = bodyTooLargeError(tooLarge.Limit)
+					}
+					result.Error = &apiErr
+				case int64(len(job.raw)) > maxBodyBytes:
+					apiErr := bodyTooLargeError(maxBodyBytes)
+					result.Error = &apiErr
+				default:
+					req, _, apiErr := fa.prepareRawRequest(job.raw, prepareOptions{})
+					result.CompanyID = req.Company.ID
+					if apiErr != nil {
+						result.Error = apiErr
+					} else {
+						result.Analysis = inOrder(fa.runAnalysis(req), req.Order)
+					}
+				}
+
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+		if err := emit(result); err != nil {
+			cancel()
+		}
+	}
+}
+
+// batchHandler analyzes every request of a BatchRequest. With
+// Accept: application/x-ndjson the requests are decoded one at a time as
+// workers take them, and each result is written and flushed as its own line
+// as soon as it completes, so memory stays flat however large the batch;
+// otherwise the results are returned together in request order. A client
+// disconnect cancels the remaining work.
+func (fa *FinancialAnalyzer) batchHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		next, err := streamSource(json.NewDecoder(r.Body))
+		if errors.Is(err, errEmptyBatch) {
+			http.Error(w, "At least one request is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", ndjsonContentType)
+		rc := http.NewResponseController(w)
+		// HTTP/1 stops reading a request body once the response is written
+		// unless both directions are enabled
+		rc.EnableFullDuplex()
+		encoder := json.NewEncoder(w)
+		analyzer.runBatch(r.Context(), next, 0, batchWorkers, func(result BatchResult) error {
+			result.Analysis = inZone(result.Analysis, loc)
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+			return rc.Flush()
+		})
+		return
+	}
+
+	var batch BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if len(batch.Requests) == 0 {
+		http.Error(w, "At least one request is required", http.StatusBadRequest)
+		return
+	}
+
+	workers := min(batchWorkers, len(batch.Requests))
+	results := make([]BatchResult, len(batch.Requests))
+	analyzer.runBatch(r.Context(), sliceSource(batch.Requests), len(batch.Requests), workers, func(result BatchResult) error {
+		result.Analysis = inZone(result.Analysis, loc)
+		results[result.Index] = result
+		return nil
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// BankImport is the AnalysisRequest built from a bank statement, with the
+// span of the transactions it was aggregated from
+type BankImport struct {
+	Request      AnalysisRequest `json:"request"`
+	Transactions int             `json:"transactions"`
+	FirstPeriod  string          `json:"first_period"`
+	LastPeriod   string          `json:"last_period"`
+}
+
+// parseBankCSV aggregates a bank statement into monthly history: credits
+// become income and debits expense. Months without transactions between the
+// first and last one are included with zero values so the history stays
+// consecutive. The description column is only required to be present.
+func parseBankCSV(r io.Reader, format BankCSVFormat) (BankImport, error) {
+	var result BankImport
+
+	reader := csv.NewReader(r)
+	if delim := []rune(format.Delimiter); len(delim) == 1 {
+		reader.Comma = delim[0]
+	} else {
+		return result, fmt.Errorf("delimiter must be a single character, got %q", format.Delimiter)
+	}
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return result, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))] = i
+	}
+	index := func(name string) (int, error) {
+		i, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("column %q not found in header %v", name, header)
+		}
+		return i, nil
+	}
+	dateCol, err := index(format.DateColumn)
+	if err != nil {
+		return result, err
+	}
+	if _, err := index(format.DescriptionColumn); err != nil {
+		return result, err
+	}
+	amountCol, err := index(format.AmountColumn)
+	if err != nil {
+		return result, err
+	}
+
+	totals := make(map[time.Time]*FinancialData)
+	var first, last time.Time
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		date, err := time.Parse(format.DateFormat, strings.TrimSpace(record[dateCol]))
+		if err != nil {
+			return result, fmt.Errorf("line %d: invalid date %q for format %q", line, record[dateCol], format.DateFormat)
+		}
+		amount, err := parseLocaleNumber(record[amountCol])
+		if err != nil || math.IsInf(amount, 0) || math.IsNaN(amount) {
+			return result, fmt.Errorf("line %d: invalid amount %q", line, record[amountCol])
+		}
+
+		period := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		month, ok := totals[period]
+		if !ok {
+			month = &FinancialData{}
+			totals[period] = month
+		}
+		if amount >= 0 {
+			month.Income += amount
+		} else {
+			month.Expense -= amount
+		}
+		if first.IsZero() || period.Before(first) {
+			first = period
+		}
+		if period.After(last) {
+			last = period
+		}
+		result.Transactions++
+	}
+	if result.Transactions == 0 {
+		return result, errors.New("statement has no transactions")
+	}
+
+	for period := first; !period.After(last); period = period.AddDate(0, 1, 0) {
+		month := FinancialData{Month: turkishMonths[period.Month()-1]}
+		if t, ok := totals[period]; ok {
+			month.Income = math.Round(t.Income*100) / 100
+			month.Expense = math.Round(t.Expense*100) / 100
+		}
+		month.NetFlow = math.Round((month.Income-month.Expense)*100) / 100
+		result.Request.HistoricalData = append(result.Request.HistoricalData, month)
+	}
+	result.FirstPeriod = first.Format("2006-01")
+	result.LastPeriod = last.Format("2006-01")
+	return result, nil
+}
+
+// bankImportHandler turns a bank statement CSV body into an AnalysisRequest.
+// Query parameters date_column, description_column, amount_column,
+// date_format and delimiter override the configured bank_csv mapping;
+// company_id, company_name and sector fill in the company.
+func (fa *FinancialAnalyzer) bankImportHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	format := analyzer.Config.BankCSV
+	query := r.URL.Query()
+	for param, field := range map[string]*string{
+		"date_column":        &format.DateColumn,
+		"description_column": &format.DescriptionColumn,
+		"amount_column":      &format.AmountColumn,
+		"date_format":        &format.DateFormat,
+		"delimiter":          &format.Delimiter,
+	} {
+		if v := query.Get(param); v != "" {
+			*field = v
+		}
+	}
+
+	imported, err := parseBankCSV(r.Body, format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeBodyTooLarge(w, tooLarge.Limit)
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, APIError{Error: "invalid_csv", Message: err.Error()})
+		return
+	}
+	imported.Request.Company = CompanyProfile{
+		ID:     query.Get("company_id"),
+		Name:   query.Get("company_name"),
+		Sector: query.Get("sector"),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imported)
+}
+
+// Alignment policies for histories of different lengths in a merge forecast
+const (
+	alignTruncate = "truncate"
+	alignZeroFill = "zero_fill"
+)
+
+// MergeRequest forecasts the entity formed by merging two companies
+type MergeRequest struct {
+	First  json.RawMessage `json:"first"`
+	Second json.RawMessage `json:"second"`
+	// Alignment is truncate (default) or zero_fill
+	Alignment string `json:"alignment"`
+}
+
+// MergeAlignment reports how the two histories were lined up
+type MergeAlignment struct {
+	Policy       string `json:"policy"`
+	FirstMonths  int    `json:"first_months"`
+	SecondMonths int    `json:"second_months"`
+	MergedMonths int    `json:"merged_months"`
+	// Misaligned is true when the histories differed in length and the
+	// policy dropped or zero-filled months
+	Misaligned bool `json:"misaligned"`
+}
+
+// MergeForecast is the analysis of the merged entity
+type MergeForecast struct {
+	Alignment MergeAlignment     `json:"alignment"`
+	Analysis  *FinancialAnalysis `json:"analysis"`
+}
+
+// mergeRequests combines two requests into one for the merged entity. Both
+// histories must be consecutive months ending in the same month; they are
+// aligned on that last month and summed. When one is longer, truncate drops
+// its older months and zero_fill pads the shorter one with zero months.
+// Every other option comes from first, except events, which both keep, and
+// the opening balances, which are added. Amounts are summed unconverted, so
+// companies reporting in different currencies cannot be merged; the merged
+// company reports in the currency either names.
+func (fa *FinancialAnalyzer) mergeRequests(first, second AnalysisRequest, policy string) (AnalysisRequest, MergeAlignment, error) {
+	alignment := MergeAlignment{
+		Policy:       policy,
+		FirstMonths:  len(first.HistoricalData),
+		SecondMonths: len(second.HistoricalData),
+		Misaligned:   len(first.HistoricalData) != len(second.HistoricalData),
+	}
+
+	firstCurrency, _ := currencyMismatches(first.Company, first.HistoricalData)
+	secondCurrency, _ := currencyMismatches(second.Company, second.HistoricalData)
+	if firstCurrency != "" && secondCurrency != "" && firstCurrency != secondCurrency {
+		return AnalysisRequest{}, alignment, &FieldError{
+			Field: "second.company.currency",
+			Err:   fmt.Errorf("%w: first reports in %s and second in %s; convert one before merging", ErrCurrencyMismatch, firstCurrency, secondCurrency),
+		}
+	}
+
+	longer, shorter := first.HistoricalData, second.HistoricalData
+	if len(shorter) > len(longer) {
+		longer, shorter = shorter, longer
+	}
+	offset := len(longer) - len(shorter)
+	for i, d := range shorter {
+		if fa.getMonthIndex(d.Month) != fa.getMonthIndex(longer[offset+i].Month) {
+			return AnalysisRequest{}, alignment, fmt.Errorf("histories do not line up: %s in one is matched with %s in the other; both must be consecutive months ending in the same month", d.Month, longer[offset+i].Month)
+		}
+	}
+
+	if policy == alignTruncate {
+		longer = longer[offset:]
+		offset = 0
+	}
+	merged := make([]FinancialData, len(longer))
+	for i, d := range longer {
+		merged[i] = FinancialData{Month: d.Month, Income: d.Income, Expense: d.Expense, NetFlow: d.NetFlow}
+		if i >= offset {
+			s := shorter[i-offset]
+			merged[i].Income += s.Income
+			merged[i].Expense += s.Expense
+			merged[i].NetFlow += s.NetFlow
+		}
+	}
+	alignment.MergedMonths = len(merged)
+
+	req := first
+	req.Company = CompanyProfile{
+		ID:                   first.Company.ID + "+" + second.Company.ID,
+		Name:                 first.Company.Name + " + " + second.Company.Name,
+		MonthlyAvgIncome:     first.Company.MonthlyAvgIncome + second.Company.MonthlyAvgIncome,
+		MonthlyAvgExpense:    first.Company.MonthlyAvgExpense + second.Company.MonthlyAvgExpense,
+		FiscalYearStartMonth: first.Company.FiscalYearStartMonth,
+		EmployeeCount:        first.Company.EmployeeCount + second.Company.EmployeeCount,
+		Currency:             cmp.Or(firstCurrency, secondCurrency),
+	}
+	if first.Company.Sector == second.Company.Sector {
+		req.Company.Sector = first.Company.Sector
+	}
+	req.HistoricalData = merged
+	req.Events = append(slices.Clone(first.Events), second.Events...)
+	if second.OpeningBalance != nil {
+		balance := *second.OpeningBalance
+		if first.OpeningBalance != nil {
+			balance += *first.OpeningBalance
+		}
+		req.OpeningBalance = &balance
+	}
+	return req, alignment, nil
+}
+
+// mergeForecastHandler forecasts a hypothetical merger of two companies
+func (fa *FinancialAnalyzer) mergeForecastHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	var merge MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if merge.Alignment == "" {
+		merge.Alignment = alignTruncate
+	}
+	if merge.Alignment != alignTruncate && merge.Alignment != alignZeroFill {
+		http.Error(w, fmt.Sprintf("Unsupported alignment %q", merge.Alignment), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var requests [2]AnalysisRequest
+	for i, raw := range []json.RawMessage{merge.First, merge.Second} {
+		name := []string{"first", "second"}[i]
+		if len(raw) == 0 {
+			writeAPIError(w, http.StatusBadRequest, APIError{Error: "missing_request", Message: name + " is required", Field: name})
+			return
+		}
+		req, _, apiErr := analyzer.prepareRawRequest(raw, prepareOptions{})
+		if apiErr != nil {
+			apiErr.Message = name + ": " + apiErr.Message
+			writeAPIError(w, http.StatusBadRequest, *apiErr)
+			return
+		}
+		requests[i] = req
+	}
+
+	req, alignment, err := analyzer.mergeRequests(requests[0], requests[1], merge.Alignment)
+	if errors.Is(err, ErrCurrencyMismatch) {
+		status, apiErr := analyzerAPIError(err)
+		writeAPIError(w, status, apiErr)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MergeForecast{Alignment: alignment, Analysis: inZone(analyzer.runAnalysis(req), loc)})
+}
+
+// PortfolioRequest consolidates several companies' forecasts into one currency
+type PortfolioRequest struct {
+	Companies []json.RawMessage `json:"companies"`
+	// TargetCurrency is the currency the portfolio is reported in
+	TargetCurrency string `json:"target_currency"`
+	// ExchangeRates is the value of one unit of each currency in the target
+	// currency, e.g. {"USD": 32.5, "EUR": 35.1} for a TRY portfolio
+	ExchangeRates map[string]float64 `json:"exchange_rates"`
+}
+
+// PortfolioCompany is one company's forecast in the target currency
+type PortfolioCompany struct {
+	CompanyID             string  `json:"company_id"`
+	Name                  string  `json:"name"`
+	Currency              string  `json:"currency"`
+	ExchangeRate          float64 `json:"exchange_rate"`
+	PredictedTotalIncome  float64 `json:"predicted_total_income"`
+	PredictedTotalExpense float64 `json:"predicted_total_expense"`
+	PredictedTotalNetFlow float64 `json:"predicted_total_net_flow"`
+	RiskScore             float64 `json:"risk_score"`
+	RiskLevelCode         string  `json:"risk_level_code"`
+}
+
+// PortfolioSummary is the consolidated forecast of a portfolio
+type PortfolioSummary struct {
+	TargetCurrency        string             `json:"target_currency"`
+	Companies             []PortfolioCompany `json:"companies"`
+	Predictions           []PortfolioMonth   `json:"predictions"`
+	PredictedTotalIncome  float64            `json:"predicted_total_income"`
+	PredictedTotalExpense float64            `json:"predicted_total_expense"`
+	PredictedTotalNetFlow float64            `json:"predicted_total_net_flow"`
+	// RiskiestCompanies are the companies with the highest risk scores
+	RiskiestCompanies []PortfolioCompany `json:"riskiest_companies"`
+}
+
+// PortfolioMonth is one calendar month of the consolidated forecast. Period
+// is its ISO month, since histories ending in different months forecast
+// different stretches of the calendar, and Companies is how many of the
+// companies forecast it.
+type PortfolioMonth struct {
+	Period string `json:"period"`
+	FinancialData
+	Companies int `json:"companies"`
+}
+
+// riskiestPortfolioCompanies is the number of companies listed as riskiest
+const riskiestPortfolioCompanies = 3
+
+// exchangeRate returns the rate converting currency into target. A company
+// without a currency is taken to report in the target currency.
+func exchangeRate(currency, target string, rates map[string]float64) (float64, error) {
+	if currency == "" || currency == target {
+		return 1, nil
+	}
+	rate, ok := rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("exchange_rates has no rate for %s", currency)
+	}
+	return rate, nil
+}
+
+// consolidatePortfolio converts each analysis into the target currency and
+// sums the forecasts by calendar month, dating each company's predictions
+// from its own last historical month
+func (fa *FinancialAnalyzer) consolidatePortfolio(analyses []*FinancialAnalysis, rates []float64, target string) PortfolioSummary {
+	portfolio := PortfolioSummary{TargetCurrency: target}
+	months := make(map[string]*PortfolioMonth)
+	for i, analysis := range analyses {
+		rate := rates[i]
+		summary := analysis.Summary
+		company := PortfolioCompany{
+			CompanyID:             analysis.Company.ID,
+			Name:                  analysis.Company.Name,
+			Currency:              cmp.Or(analysis.Company.Currency, target),
+			ExchangeRate:          rate,
+			PredictedTotalIncome:  math.Round(summary.PredictedTotalIncome*rate*100) / 100,
+			PredictedTotalExpense: math.Round(summary.PredictedTotalExpense*rate*100) / 100,
+			PredictedTotalNetFlow: math.Round(summary.PredictedTotalNetFlow*rate*100) / 100,
+			RiskScore:             summary.RiskScore,
+			RiskLevelCode:         summary.RiskLevelCode,
+		}
+		portfolio.Companies = append(portfolio.Companies, company)
+		portfolio.PredictedTotalIncome += company.PredictedTotalIncome
+		portfolio.PredictedTotalExpense += company.PredictedTotalExpense
+		portfolio.PredictedTotalNetFlow += company.PredictedTotalNetFlow
+
+		last := fa.lastHistoricalMonth(analysis.HistoricalData)
+		for j, p := range analysis.Predictions {
+			period := last.AddDate(0, j+1, 0).Format("2006-01")
+			month, ok := months[period]
+			if !ok {
+				month = &PortfolioMonth{Period: period, FinancialData: FinancialData{Month: p.Month, Confidence: 1}}
+				months[period] = month
+			}
+			month.Income += p.Income * rate
+			month.Expense += p.Expense * rate
+			month.Confidence = math.Min(month.Confidence, p.Confidence)
+			month.Companies++
+		}
+	}
+
+	for _, period := range slices.Sorted(maps.Keys(months)) {
+		month := months[period]
+		month.Income = math.Round(month.Income*100) / 100
+		month.Expense = math.Round(month.Expense*100) / 100
+		month.NetFlow = math.Round((month.Income-month.Expense)*100) / 100
+		portfolio.Predictions = append(portfolio.Predictions, *month)
+	}
+	portfolio.PredictedTotalIncome = math.Round(portfolio.PredictedTotalIncome*100) / 100
+	portfolio.PredictedTotalExpense = math.Round(portfolio.PredictedTotalExpense*100) / 100
+	portfolio.PredictedTotalNetFlow = math.Round(portfolio.PredictedTotalNetFlow*100) / 100
+
+	riskiest := slices.Clone(portfolio.Companies)
+	slices.SortStableFunc(riskiest, func(a, b PortfolioCompany) int {
+		return cmp.Compare(b.RiskScore, a.RiskScore)
+	})
+	portfolio.RiskiestCompanies = riskiest[:min(len(riskiest), riskiestPortfolioCompanies)]
+	return portfolio
+}
+
+// portfolioHandler forecasts every company of a portfolio and consolidates
+// them in the target currency
+func (fa *FinancialAnalyzer) portfolioHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	var portfolio PortfolioRequest
+	if err := json.NewDecoder(r.Body).Decode(&portfolio); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if len(portfolio.Companies) == 0 {
+		http.Error(w, "At least one company is required", http.StatusBadRequest)
+		return
+	}
+	target := normalizeCurrency(portfolio.TargetCurrency)
+	if target == "" {
+		writeAPIError(w, http.StatusBadRequest, APIError{Error: "missing_currency", Message: "target_currency is required", Field: "target_currency"})
+		return
+	}
+	rates := make(map[string]float64, len(portfolio.ExchangeRates))
+	for currency, rate := range portfolio.ExchangeRates {
+		if rate <= 0 || math.IsInf(rate, 0) {
+			writeAPIError(w, http.StatusBadRequest, APIError{Error: "invalid_exchange_rate", Message: fmt.Sprintf("exchange rate of %s must be positive", currency), Field: "exchange_rates." + currency})
+			return
+		}
+		rates[normalizeCurrency(currency)] = rate
+	}
+
+	requests := make([]AnalysisRequest, len(portfolio.Companies))
+	companyRates := make([]float64, len(portfolio.Companies))
+	for i, raw := range portfolio.Companies {
+		field := fmt.Sprintf("companies[%d]", i)
+		req, _, apiErr := analyzer.prepareRawRequest(raw, prepareOptions{})
+		if apiErr != nil {
+			apiErr.Message = field + ": " + apiErr.Message
+			writeAPIError(w, http.StatusBadRequest, *apiErr)
+			return
+		}
+		req.Company.Currency = normalizeCurrency(req.Company.Currency)
+		rate, err := exchangeRate(req.Company.Currency, target, rates)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{Error: "missing_exchange_rate", Message: field + ": " + err.Error(), Field: field + ".company.currency"})
+			return
+		}
+		requests[i] = req
+		companyRates[i] = rate
+	}
+
+	analyses := make([]*FinancialAnalysis, len(requests))
+	for i, req := range requests {
+		analyses[i] = analyzer.runAnalysis(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzer.consolidatePortfolio(analyses, companyRates, target))
+}
+
+// stressHandler runs the forecast under predefined and custom shocks
+func (fa *FinancialAnalyzer) stressHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	// The analysis part goes through the same validation as analyze; the
+	// shocks are the only field of its own
+	analysisReq, status, apiErr := analyzer.prepareRawRequest(body, prepareOptions{})
+	if apiErr != nil {
+		writeAPIError(w, status, *apiErr)
+		return
+	}
+	req := StressRequest{AnalysisRequest: analysisReq}
+	var shocks struct {
+		Shocks []StressShock `json:"shocks"`
+	}
+	if err := json.Unmarshal(body, &shocks); err != nil {
+		writeAPIError(w, http.StatusBadRequest, APIError{Error: "invalid_json", Message: err.Error(), Field: "shocks"})
+		return
+	}
+	req.Shocks = shocks.Shocks
+
+	horizon, err := analyzer.forecastUntilMonths(req.HistoricalData, req.ForecastUntil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, shock := range req.Shocks {
+		if err := validateShock(shock, horizon); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzer.stressTest(req))
+}
+
+// Diagnostics settings. A month is an anomaly when its income is more than
+// anomalyThreshold standard deviations from the linear trend. A trend with
+// an R² of at least strongTrendR2 suits compounding; income growth more
+// volatile than highVolatility with a weaker trend calls for the
+// conservative model.
+const (
+	anomalyThreshold = 2.5
+	strongTrendR2    = 0.7
+	highVolatility   = 0.25
+)
+
+// DiagnosticsReport describes how fit a history is for forecasting
+type DiagnosticsReport struct {
+	Months                int `json:"months"`
+	ZeroIncomeMonths      int `json:"zero_income_months"`
+	NegativeNetFlowMonths int `json:"negative_net_flow_months"`
+	// SeasonalityStrength is the gap between the strongest and weakest
+	// calendar month of the income profile; nil below seasonal_min_history
+	SeasonalityStrength *float64 `json:"seasonality_strength"`
+	SeasonalityDetected bool     `json:"seasonality_detected"`
+	IncomeVolatility    float64  `json:"income_volatility"`
+	ExpenseVolatility   float64  `json:"expense_volatility"`
+	// IncomeTrendR2 is the share of income variance a straight line explains
+	IncomeTrendR2    float64           `json:"income_trend_r2"`
+	AnomalyMonths    []string          `json:"anomaly_months"`
+	ExpenseStep      *ExpenseStep      `json:"expense_step,omitempty"`
+	RecommendedModel string            `json:"recommended_model"`
+	Reason           string            `json:"reason"`
+	Warnings         []AnalysisWarning `json:"warnings,omitempty"`
+}
+
+// diagnose reports the data-quality indicators of req's history and the
+// model that suits it, without forecasting
+func (fa *FinancialAnalyzer) diagnose(req AnalysisRequest) DiagnosticsReport {
+	historical := windowHistory(req.HistoricalData, req.HistoryWindow)
+	report := DiagnosticsReport{
+		Months:        len(historical),
+		AnomalyMonths: []string{},
+		ExpenseStep:   detectExpenseStep(historical),
+		Warnings:      fa.dataWarnings(req.Company, historical),
+	}
+	for _, h := range historical {
+		if h.Income == 0 {
+			report.ZeroIncomeMonths++
+		}
+		if h.NetFlow < 0 {
+			report.NegativeNetFlowMonths++
+		}
+	}
+
+	if len(historical) >= fa.Config.SeasonalMinHistory {
+		if profile := fa.seasonalProfile(historical, func(d FinancialData) float64 { return d.Income }); profile != nil {
+			strength := math.Round((slices.Max(profile)-slices.Min(profile))*10000) / 10000
+			report.SeasonalityStrength = &strength
+			report.SeasonalityDetected = strength >= minSeasonalSwing
+		}
+	}
+
+	incomeVolatility, _ := growthVolatility(historical)
+	expenseVolatility, _ := seriesVolatility(historical, func(d FinancialData) float64 { return d.Expense })
+	report.IncomeVolatility = math.Round(incomeVolatility*10000) / 10000
+	report.ExpenseVolatility = math.Round(expenseVolatility*10000) / 10000
+
+	incomes := seriesValues(historical, "income")
+	intercept, slope := linearFit(incomes)
+	var mean, residualSS, totalSS float64
+	for _, v := range incomes {
+		mean += v / float64(len(incomes))
+	}
+	residuals := make([]float64, len(incomes))
+	for i, v := range incomes {
+		residuals[i] = v - (intercept + slope*float64(i))
+		residualSS += residuals[i] * residuals[i]
+		totalSS += (v - mean) * (v - mean)
+	}
+	if totalSS > 0 {
+		report.IncomeTrendR2 = math.Round((1-residualSS/totalSS)*10000) / 10000
+	}
+	if len(incomes) > 2 {
+		sd := math.Sqrt(residualSS / float64(len(incomes)-2))
+		for i, r := range residuals {
+			if sd > 0 && math.Abs(r) > anomalyThreshold*sd {
+				report.AnomalyMonths = append(report.AnomalyMonths, historical[i].Month)
+			}
+		}
+	}
+
+	switch {
+	case len(historical) < 3:
+		report.RecommendedModel = modelConservative
+		report.Reason = "Eğilim ölçmek için en az 3 ay gerekli: gelir sabit varsayılmalı"
+	case report.SeasonalityDetected:
+		report.RecommendedModel = modelDecompose
+		report.Reason = "Belirgin mevsimsellik var: eğilim ve mevsim etkisi ayrıştırılmalı"
+	case report.IncomeTrendR2 < strongTrendR2 && incomeVolatility > highVolatility:
+		report.RecommendedModel = modelConservative
+		report.Reason = "Gelir çok dalgalı ve belirgin bir eğilim yok: büyüme varsayımı güvenilmez"
+	default:
+		report.RecommendedModel = modelCompound
+		report.Reason = "Gelir eğilimi yeterince düzenli: bileşik büyüme uygun"
+	}
+	return report
+}
+
+// diagnosticsHandler reports whether a history is fit for forecasting and
+// which model to pick, without running the forecast
+func (fa *FinancialAnalyzer) diagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req, status, apiErr := analyzer.prepareRawRequest(body, prepareOptions{})
+	if apiErr != nil {
+		writeAPIError(w, status, *apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzer.diagnose(req))
+}
+
+// trendHandler returns only the growth rates and trend of a submitted history,
+// skipping the forecast and recommendations. The body is validated like
+// analyze, so trust_net_flow keeps the supplied net flows here too.
+func (fa *FinancialAnalyzer) trendHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	req, status, apiErr := analyzer.prepareRawRequest(body, prepareOptions{})
+	if apiErr != nil {
+		writeAPIError(w, status, *apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(analyzer.analyzeTrend(req)); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// rerunHandler replays a stored analysis with a different model or config
+func (fa *FinancialAnalyzer) rerunHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	stored, ok := analyzer.store.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+
+	var req RerunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if req.Model != "" && !slices.Contains(supportedModels, req.Model) {
+		http.Error(w, fmt.Sprintf("Unsupported model %q", req.Model), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	analysis, err := analyzer.rerunAnalysis(stored, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inOrder(inZone(analysis, loc), stored.Request.Order))
+}
+
+// actualsHandler compares realized months against a stored analysis
+func (fa *FinancialAnalyzer) actualsHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	stored, ok := analyzer.store.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+
+	var req ActualsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range req.Actuals {
+		req.Actuals[i].Month = analyzer.canonicalMonth(req.Actuals[i].Month)
+	}
+	// Months posted earlier for this analysis are kept unless posted again,
+	// so repeating actuals does not count them twice
+	actuals := req.Actuals
+	if previous, ok := analyzer.store.Comparison(stored.Analysis.Company.ID, stored.Analysis.ID); ok {
+		for _, m := range previous.Months {
+			if !slices.ContainsFunc(actuals, func(a FinancialData) bool { return a.Month == m.Month }) {
+				actuals = append(actuals, FinancialData{Month: m.Month, Income: m.ActualIncome, Expense: m.ActualExpense})
+			}
+		}
+		position := func(a FinancialData) int {
+			return slices.IndexFunc(stored.Analysis.Predictions, func(p FinancialData) bool { return p.Month == a.Month })
+		}
+		slices.SortStableFunc(actuals, func(a, b FinancialData) int { return cmp.Compare(position(a), position(b)) })
+	}
+
+	comparison := analyzer.compareActuals(stored, actuals)
+	if len(comparison.Months) == 0 {
+		http.Error(w, "No actuals match the predicted months", http.StatusBadRequest)
+		return
+	}
+
+	accuracy := analyzer.store.AddComparison(comparison)
+	comparison.ComparedAt = comparison.ComparedAt.In(loc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comparison":       comparison,
+		"company_accuracy": accuracy,
+	})
+}
+
+// healthHandler provides health check endpoint
+func (fa *FinancialAnalyzer) healthHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("health check", "method", r.Method)
+
+	loc, err := requestZone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "healthy",
-		"time":    time.Now().Format(time.RFC3339),
+		"time":    fa.now().In(loc).Format(time.RFC3339),
 		"service": "KOBİ Financial Analysis API",
 	})
 }
 
+// Capabilities describes what the API accepts so clients need not hard-code it
+type Capabilities struct {
+	Models                []string                             `json:"models"`
+	GrowthMethods         []string                             `json:"growth_methods"`
+	DecompositionModes    []string                             `json:"decomposition_modes"`
+	ModelParams           map[string]map[string]ModelParamSpec `json:"model_params"`
+	SchemaVersions        []int                                `json:"schema_versions"`
+	Locales               []string                             `json:"locales"`
+	Currencies            []string                             `json:"currencies"`
+	MinHorizonMonths      int                                  `json:"min_horizon_months"`
+	DefaultHorizonMonths  int                                  `json:"default_horizon_months"`
+	MaxHorizonMonths      int                                  `json:"max_horizon_months"`
+	MinHistoryMonths      int                                  `json:"min_history_months"`
+	SeasonalHistoryMonths int                                  `json:"seasonal_history_months"`
+	MaxHistoryMonths      int                                  `json:"max_history_months"`
+	MaxBodyBytes          int64                                `json:"max_body_bytes"`
+	MaxBatchBytes         int64                                `json:"max_batch_bytes"`
+	Features              []string                             `json:"features"`
+	MultiTenant           bool                                 `json:"multi_tenant"`
+}
+
+// Query options of /api/analyze that capabilities reports as features
+const (
+	queryStrict          = "strict"
+	queryTolerantNumbers = "tolerant_numbers"
+	queryFormat          = "format"
+	formatTidy           = "tidy"
+)
+
+// capabilityFeature is a feature of /api/capabilities and where it lives:
+// an AnalysisRequest field, an endpoint pattern or an analyze query option
+type capabilityFeature struct {
+	Name  string
+	Field string
+	Route string
+	Query string
+}
+
+// capabilityFeatures are the features capabilities may report. A field
+// feature is listed only while the request schema has the field and a route
+// feature only while the route is registered, so the list cannot drift from
+// the code.
+var capabilityFeatures = []capabilityFeature{
+	{Name: "events", Field: "events"},
+	{Name: "budget", Field: "budget"},
+	{Name: "opening_balance", Field: "opening_balance"},
+	{Name: "trust_net_flow", Field: "trust_net_flow"},
+	{Name: "tolerant_numbers", Query: queryTolerantNumbers},
+	{Name: "strict", Query: queryStrict},
+	{Name: "tidy_format", Query: queryFormat},
+	{Name: "annualized", Field: "annualized"},
+	{Name: "history_window", Field: "history_window"},
+	{Name: "seasonally_adjusted", Field: "seasonally_adjusted"},
+	{Name: "rerun", Route: "/api/analyses/{id}/rerun"},
+	{Name: "actuals", Route: "/api/analyses/{id}/actuals"},
+	{Name: "stress", Route: "/api/stress"},
+	{Name: "batch", Route: "/api/batch"},
+	{Name: "merge_forecast", Route: "/api/merge-forecast"},
+	{Name: "bank_csv_import", Route: "/api/import/bank-csv"},
+	{Name: "admin_reload", Route: "/api/admin/reload"},
+	{Name: "portfolio", Route: "/api/portfolio"},
+	{Name: "forecast_until", Field: "forecast_until"},
+	{Name: "diagnostics", Route: "/api/diagnostics"},
+	{Name: "model_params", Field: "model_params"},
+	{Name: "audit_log", Route: "/api/admin/audit"},
+	{Name: "break_even", Field: "simulations"},
+	{Name: "capital_injection", Field: "capital_injection"},
+}
+
+// enabledFeatures returns the names of capabilityFeatures whose field or
+// route exists
+func enabledFeatures() []string {
+	features := []string{}
+	for _, f := range capabilityFeatures {
+		switch {
+		case f.Field != "":
+			if analysisRequestSchema.Properties[f.Field] == nil {
+				continue
+			}
+		case f.Route != "":
+			if !slices.Contains(registeredRoutes, f.Route) {
+				continue
+			}
+		}
+		features = append(features, f.Name)
+	}
+	return features
+}
+
+// capabilities reports the limits and features of the running configuration.
+// A MaxHistoryMonths of 0 means the history size is not limited, and empty
+// Currencies that any ISO 4217 code is accepted: amounts are never
+// converted, except by /api/portfolio at the caller's exchange rates.
+func (fa *FinancialAnalyzer) capabilities() Capabilities {
+	return Capabilities{
+		Models:                supportedModels,
+		GrowthMethods:         supportedGrowthMethods,
+		DecompositionModes:    []string{decomposeMultiplicative, decomposeAdditive},
+		ModelParams:           modelParamSpecs,
+		SchemaVersions:        supportedSchemaVersions,
+		Locales:               []string{"tr-TR"},
+		Currencies:            []string{},
+		MinHorizonMonths:      1,
+		DefaultHorizonMonths:  forecastHorizon,
+		MaxHorizonMonths:      fa.Config.MaxHorizon,
+		MinHistoryMonths:      1,
+		SeasonalHistoryMonths: fa.Config.SeasonalMinHistory,
+		MaxHistoryMonths:      0,
+		MaxBodyBytes:          maxBodyBytes,
+		MaxBatchBytes:         maxBatchBytes,
+		Features:              enabledFeatures(),
+		MultiTenant:           len(fa.tenants) > 0,
+	}
+}
+
+// adminReloadHandler re-reads the config and tenants files and swaps them in
+// for new requests. It needs the admin key in X-Admin-Key and is disabled
+// when no admin key is configured. max_body_bytes still needs a restart.
+func (fa *FinancialAnalyzer) adminReloadHandler(adminKey, configPath, tenantsPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r, adminKey) {
+			return
+		}
+
+		config, err := loadConfig(configPath)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, APIError{Error: "reload_failed", Message: err.Error()})
+			return
+		}
+		tenants, err := loadTenants(tenantsPath, config)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, APIError{Error: "reload_failed", Message: err.Error()})
+			return
+		}
+		fa.Reload(config, tenants)
+		logger.Info("configuration reloaded", "config", configPath, "tenants", len(tenants))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"config":      config,
+			"tenants":     len(tenants),
+			"reloaded_at": fa.now().Format(time.RFC3339),
+		})
+	}
+}
+
+// adminAuthorized checks the X-Admin-Key header of an admin request and
+// writes the error response when it fails. Admin endpoints are disabled when
+// no admin key is configured.
+func adminAuthorized(w http.ResponseWriter, r *http.Request, adminKey string) bool {
+	if adminKey == "" {
+		http.Error(w, "Admin endpoints are disabled", http.StatusNotFound)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(adminKey)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, APIError{Error: "unauthorized", Message: "A valid X-Admin-Key header is required"})
+		return false
+	}
+	return true
+}
+
+// defaultAuditLimit is how many entries the audit endpoint returns by default
+const defaultAuditLimit = 100
+
+// adminAuditHandler returns the most recent audit entries, newest first,
+// optionally filtered by company_id and capped by limit
+func (fa *FinancialAnalyzer) adminAuditHandler(adminKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r, adminKey) {
+			return
+		}
+
+		limit := defaultAuditLimit
+		if param := r.URL.Query().Get("limit"); param != "" {
+			n, err := strconv.Atoi(param)
+			if err != nil || n < 1 || n > auditRecentEntries {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", auditRecentEntries), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"entries": fa.audit.Recent(limit, r.URL.Query().Get("company_id")),
+			"dropped": fa.audit.dropped.Load(),
+		})
+	}
+}
+
+// capabilitiesHandler returns the API's limits and supported options
+func (fa *FinancialAnalyzer) capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fa.forRequest(r).capabilities())
+}
+
+// schemaHandler serves the JSON Schema that /api/analyze validates against
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(analysisRequestSchema)
+}
+
+// metricsHandler reports runtime counters such as cache hits and misses
+func (fa *FinancialAnalyzer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	analyzer := fa.forRequest(r)
+
+	var cacheStats CacheStats
+	if analyzer.cache != nil {
+		cacheStats = analyzer.cache.Stats()
+	}
+	storeStats := map[string]int{}
+	if analyzer.store != nil {
+		storeStats["size"], storeStats["capacity"] = analyzer.store.Len(), analyzer.store.capacity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cache": cacheStats,
+		"store": storeStats,
+		"batch": map[string]interface{}{
+			"workers":     batchWorkers,
+			"queue_depth": batchQueueDepth.Load(),
+		},
+	})
+}
+
 // Simple home handler
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("Home - Method: %s, Path: %s\n", r.Method, r.URL.Path)
+	logger.Debug("home request", "method", r.Method, "path", r.URL.Path)
 
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]interface{}{
 		"service": "KOBİ Mali Durum Tahmin Sistemi",
 		"version": "1.0.0",
 		"endpoints": map[string]string{
-			"analyze": "POST /api/analyze",
-			"health":  "GET /api/health",
+			"analyze":      "POST " + basePath + "/api/analyze",
+			"health":       "GET " + basePath + "/api/health",
+			"metrics":      "GET " + basePath + "/api/metrics",
+			"seasonality":  "POST " + basePath + "/api/seasonality",
+			"actuals":      "POST " + basePath + "/api/analyses/{id}/actuals",
+			"schema":       "GET " + basePath + "/api/schema",
+			"trend":        "POST " + basePath + "/api/trend",
+			"diagnostics":  "POST " + basePath + "/api/diagnostics",
+			"rerun":        "POST " + basePath + "/api/analyses/{id}/rerun",
+			"capabilities": "GET " + basePath + "/api/capabilities",
+			"stress":       "POST " + basePath + "/api/stress",
+			"batch":        "POST " + basePath + "/api/batch",
+			"merge":        "POST " + basePath + "/api/merge-forecast",
+			"portfolio":    "POST " + basePath + "/api/portfolio",
+			"bank_import":  "POST " + basePath + "/api/import/bank-csv",
+			"admin_reload": "POST " + basePath + "/api/admin/reload",
+			"admin_audit":  "GET " + basePath + "/api/admin/audit",
 		},
 		"status": "running",
-		"time":   time.Now().Format("2006-01-02 15:04:05"),
+		"time":   time.Now().UTC().Format(time.RFC3339),
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// logger is the single structured logger used by the service
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// newLogger builds the service logger from LOG_LEVEL (debug, info, warn,
+// error; default info) and LOG_FORMAT (json by default, text for local use)
+func newLogger(level, format string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(os.Stdout, opts))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, opts))
+}
+
 func main() {
-	analyzer := &FinancialAnalyzer{}
+	logger = newLogger(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+
+	configPath, tenantsPath := os.Getenv("ANALYZER_CONFIG"), os.Getenv("TENANTS_CONFIG")
+	config, err := loadConfig(configPath)
+	if err != nil {
+		logger.Error("loading config failed", "error", err)
+		os.Exit(1)
+	}
+
+	tenants, err := loadTenants(tenantsPath, config)
+	if err != nil {
+		logger.Error("loading tenants failed", "error", err)
+		os.Exit(1)
+	}
+
+	analyzer := NewFinancialAnalyzer(config, tenants)
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		if err := analyzer.audit.attachFile(path); err != nil {
+			logger.Error("opening audit log failed", "error", err)
+			os.Exit(1)
+		}
+	}
+	maxBodyBytes = config.MaxBodyBytes
+	maxBatchBytes = config.MaxBatchBytes
+	if config.BatchWorkers > 0 {
+		batchWorkers = config.BatchWorkers
+	}
+	if env := os.Getenv("BATCH_WORKERS"); env != "" {
+		workers, err := strconv.Atoi(env)
+		if err != nil || workers < 1 {
+			logger.Error("invalid BATCH_WORKERS", "value", env)
+			os.Exit(1)
+		}
+		batchWorkers = workers
+	}
+	basePath = normalizeBasePath(os.Getenv("BASE_PATH"))
 
 	// Setup routes without external router
-	http.HandleFunc("/", corsMiddleware(homeHandler))
-	http.HandleFunc("/api/analyze", corsMiddleware(analyzer.analyzeHandler))
-	http.HandleFunc("/api/health", corsMiddleware(analyzer.healthHandler))
-
-	fmt.Println("🚀 KOBİ Mali Durum Tahmin Sistemi başlatılıyor...")
-	fmt.Println("🌐 Server: http://localhost:8080")
-	fmt.Println("📊 API Endpoint: http://localhost:8080/api/analyze")
-	fmt.Println("🔍 Health Check: http://localhost:8080/api/health")
-	fmt.Println("📋 Home: http://localhost:8080/")
-	fmt.Println("\n✅ Sistem hazır - test client'ını çalıştırabilirsiniz")
-
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// "/{$}" matches only the root, so unknown paths (and their preflights) get a 404
+	route("/{$}", homeHandler, http.MethodGet)
+	route("/api/analyze", analyzer.analyzeHandler, http.MethodPost)
+	route("/api/health", analyzer.healthHandler, http.MethodGet)
+	route("/api/metrics", analyzer.metricsHandler, http.MethodGet)
+	route("/api/seasonality", analyzer.seasonalityHandler, http.MethodPost)
+	route("/api/analyses/{id}/actuals", analyzer.actualsHandler, http.MethodPost)
+	route("/api/analyses/{id}/rerun", analyzer.rerunHandler, http.MethodPost)
+	route("/api/schema", schemaHandler, http.MethodGet)
+	route("/api/capabilities", analyzer.capabilitiesHandler, http.MethodGet)
+	route("/api/trend", analyzer.trendHandler, http.MethodPost)
+	route("/api/diagnostics", analyzer.diagnosticsHandler, http.MethodPost)
+	route("/api/stress", analyzer.stressHandler, http.MethodPost)
+	routeWithLimit("/api/batch", batchBodyLimit, analyzer.batchHandler, http.MethodPost)
+	route("/api/merge-forecast", analyzer.mergeForecastHandler, http.MethodPost)
+	route("/api/portfolio", analyzer.portfolioHandler, http.MethodPost)
+	route("/api/import/bank-csv", analyzer.bankImportHandler, http.MethodPost)
+	route("/api/admin/reload", analyzer.adminReloadHandler(os.Getenv("ADMIN_KEY"), configPath, tenantsPath), http.MethodPost)
+	route("/api/admin/audit", analyzer.adminAuditHandler(os.Getenv("ADMIN_KEY")), http.MethodGet)
+
+	certFile, keyFile := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	if (certFile == "") != (keyFile == "") {
+		logger.Error("TLS_CERT and TLS_KEY must be set together")
+		os.Exit(1)
+	}
+	useTLS := certFile != ""
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	srv := &http.Server{Addr: ":8080"}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		// ListenAndServeTLS also enables HTTP/2
+		if useTLS {
+			serveErr <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	logger.Info("KOBİ Mali Durum Tahmin Sistemi başlatılıyor",
+		"server", scheme+"://localhost:8080"+basePath,
+		"analyze", scheme+"://localhost:8080"+basePath+"/api/analyze",
+		"health", scheme+"://localhost:8080"+basePath+"/api/health")
+
+	select {
+	case err := <-serveErr:
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+		os.Exit(1)
+	}
+	analyzer.audit.Close()
 }
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -25,7 +27,99 @@ func main() {
 	fmt.Println("\n2️⃣  Ana API Testi:")
 	testAnalyzeAPI()
 
-	// 3. Curl örneği göster
+	// 3. Büyüme oranı yöntemleri
+	fmt.Println("\n3️⃣  Büyüme Oranı Yöntemi Testi:")
+	testGrowthMethods()
+
+	// 4. Mevsimsel faktör sınırlama
+	fmt.Println("\n4️⃣  Mevsimsel Faktör Sınırlama Testi:")
+	testSeasonalFactorClamp()
+
+	// 5. Çelişen öneriler
+	fmt.Println("\n5️⃣  Çelişen Öneri Testi:")
+	testConflictingRecommendations()
+
+	// 6. Nisan başlangıçlı mali yıl
+	fmt.Println("\n6️⃣  Mali Yıl Başlangıcı Testi:")
+	testFiscalYearStart()
+
+	// 7. Aynı aylar
+	fmt.Println("\n7️⃣  Değişkenliksiz Veri Testi:")
+	testIdenticalMonths()
+
+	// 8. Boyut sınırını aşan gövdeler
+	fmt.Println("\n8️⃣  Büyük Gövde Testi:")
+	testOversizedBodies()
+
+	// 9. Ay adı yazım farkları
+	fmt.Println("\n9️⃣  Ay Adı Normalleştirme Testi:")
+	testMonthNameVariants()
+
+	// 10. Sonlu olmayan sayılar
+	fmt.Println("\n🔟 Sonlu Olmayan Sayı Testi:")
+	testNonFiniteValues()
+
+	// 11. Mevsimsel faktör yumuşatma
+	fmt.Println("\n1️⃣1️⃣ Mevsimsel Yumuşatma Testi:")
+	testSeasonalSmoothing()
+
+	// 12. Dile bağlı olmayan karar kodları
+	fmt.Println("\n1️⃣2️⃣ Karar Kodu Testi:")
+	testVerdictCodes()
+
+	// 13. Açılış ayını büyüme hesabından çıkarma
+	fmt.Println("\n1️⃣3️⃣ Açılış Ayı Testi:")
+	testSkipGrowthPeriods()
+
+	// 14. Geçmiş uzadıkça daralan tahmin aralıkları
+	fmt.Println("\n1️⃣4️⃣ Tahmin Aralığı Testi:")
+	testIntervalNarrowing()
+
+	// 15. Havuzdan büyük toplu istek
+	fmt.Println("\n1️⃣5️⃣ Toplu İstek Havuzu Testi:")
+	testBatchLargerThanPool()
+
+	// 16. Sert düşüşte sıfır tabanı
+	fmt.Println("\n1️⃣6️⃣ Sıfır Tabanı Testi:")
+	testZeroFloor()
+
+	// 17. Net akışın doğrudan tahmini
+	fmt.Println("\n1️⃣7️⃣ Doğrudan Net Akış Testi:")
+	testDirectNetFlow()
+
+	// 18. Uzun ve kontrol karakterli metinler
+	fmt.Println("\n1️⃣8️⃣ Metin Alanı Testi:")
+	testCompanyStrings()
+
+	// 19. Pozitif/negatif net akışlı aylar
+	fmt.Println("\n1️⃣9️⃣ Net Akış Ay Sayısı Testi:")
+	testNetFlowMonths()
+
+	// 20. Tek seferlik sermaye enjeksiyonu
+	fmt.Println("\n2️⃣0️⃣ Sermaye Enjeksiyonu Testi:")
+	testCapitalInjection()
+
+	// 21. Yaşam döngüsü evresi
+	fmt.Println("\n2️⃣1️⃣ Yaşam Döngüsü Evresi Testi:")
+	testLifecyclePhase()
+
+	// 22. Aynı gerçekleşmeleri iki kez göndermek sapma düzeltmesini bozmamalı
+	fmt.Println("\n2️⃣2️⃣ Sapma Düzeltmesi Testi:")
+	testBiasCorrection()
+
+	// 23. Yan uç noktalar analiz ile aynı doğrulamadan geçmeli
+	fmt.Println("\n2️⃣3️⃣ Uç Nokta Doğrulama Testi:")
+	testEndpointValidation()
+
+	// 24. Stres testinin temel senaryosu analizin tahminiyle aynı olmalı
+	fmt.Println("\n2️⃣4️⃣ Stres Temel Senaryo Testi:")
+	testStressBaseline()
+
+	// 25. Farklı aylarda biten şirketler takvim ayına göre birleştirilmeli
+	fmt.Println("\n2️⃣5️⃣ Portföy ve Birleşme Testi:")
+	testPortfolioAndMerge()
+
+	// 26. Curl örneği göster
 	printCurlExample()
 
 	fmt.Println("\n✅ Testler tamamlandı!")
@@ -157,6 +251,1304 @@ func testAnalyzeAPI() {
 	}
 }
 
+// Önce büyüyüp sonra küçülen seride geometrik ortalamanın gerçek bileşik
+// oranı (0%) verdiğini, aritmetik ortalamanın ise büyümeyi abarttığını göster
+func testGrowthMethods() {
+	history := `[
+			{"month": "Ocak", "income": 100000, "expense": 80000},
+			{"month": "Şubat", "income": 200000, "expense": 80000},
+			{"month": "Mart", "income": 100000, "expense": 80000}
+		]`
+
+	rates := map[string]float64{}
+	for _, method := range []string{"arithmetic", "geometric"} {
+		body := fmt.Sprintf(`{
+		"company": {"id": "GROWTH001", "name": "Büyüme Testi", "sector": "Hizmet"},
+		"historical_data": %s,
+		"growth_method": %q
+	}`, history, method)
+
+		result, status, err := postAnalyze(body)
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s isteği başarısız (status %d): %v\n", method, status, err)
+			return
+		}
+
+		summary, _ := result["summary"].(map[string]interface{})
+		rate, _ := summary["income_growth_rate"].(float64)
+		rates[method] = rate
+		fmt.Printf("📊 %s ortalama: aylık %%%.2f\n", method, rate*100)
+	}
+
+	// 100k → 200k → 100k: bileşik büyüme sıfırdır
+	if rates["geometric"] == 0 && rates["arithmetic"] > rates["geometric"] {
+		fmt.Println("✅ Geometrik ortalama gerçek bileşik oranı veriyor")
+	} else {
+		fmt.Println("❌ Geometrik ortalama beklenen bileşik oranı vermedi")
+	}
+}
+
+// Tek bir ayı 10 kat yüksek olan geçmişte mevsimsel faktörün 2.0 ile
+// sınırlandığını ve tahmine olduğu gibi yansımadığını doğrula
+func testSeasonalFactorClamp() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+
+	// Faktörler ancak iki yıllık (24 ay) veriden hesaplanır
+	var history []string
+	for range 2 {
+		for _, month := range months {
+			income := 100000
+			if month == "Aralık" {
+				income = 1000000 // Her yıl 10 katlık ay
+			}
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 80000}`, month, income))
+		}
+	}
+
+	body := fmt.Sprintf(`{
+		"company": {"id": "SEASON001", "name": "Mevsim Testi", "sector": "Perakende"},
+		"historical_data": [%s]
+	}`, strings.Join(history, ","))
+
+	result, status, err := postAnalyze(body)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ İstek başarısız (status %d): %v\n", status, err)
+		return
+	}
+
+	seasonality, _ := result["seasonality"].(map[string]interface{})
+	factors, _ := seasonality["factors"].([]interface{})
+	if len(factors) != 12 {
+		fmt.Println("❌ Mevsimsel faktörler yanıtta yok")
+		return
+	}
+
+	december, _ := factors[11].(float64)
+	fmt.Printf("📊 Aralık faktörü: %.2f, sınırlanan aylar: %v\n", december, seasonality["clamped_months"])
+
+	if december <= 2.0 && seasonality["clamped_months"] != nil {
+		fmt.Println("✅ Aşırı mevsimsel faktör 2.0 ile sınırlandı")
+	} else {
+		fmt.Println("❌ Aşırı mevsimsel faktör sınırlanmadı")
+	}
+
+	// Hiç gelir olmayan iki yıllık geçmişte oran tanımsızdır: analiz hata
+	// vermeden varsayılan faktörlere dönmeli
+	history = history[:0]
+	for range 2 {
+		for _, month := range months {
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": 0, "expense": 80000}`, month))
+		}
+	}
+	body = fmt.Sprintf(`{
+		"company": {"id": "SEASON002", "name": "Gelirsiz Mevsim Testi", "sector": "Perakende"},
+		"historical_data": [%s]
+	}`, strings.Join(history, ","))
+
+	result, status, err = postAnalyze(body)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ Gelirsiz geçmiş başarısız (status %d): %v\n", status, err)
+		return
+	}
+	seasonality, _ = result["seasonality"].(map[string]interface{})
+	factors, _ = seasonality["factors"].([]interface{})
+	finite := len(factors) == 12
+	for _, f := range factors {
+		if v, ok := f.(float64); !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			finite = false
+		}
+	}
+	if finite && seasonality["source"] == "default" {
+		fmt.Println("✅ Gelirsiz geçmişte varsayılan faktörler kullanıldı")
+	} else {
+		fmt.Printf("❌ Gelirsiz geçmişte faktörler: %v (kaynak %v)\n", factors, seasonality["source"])
+	}
+}
+
+// Nisan'da başlayan mali yılda Haziran zirvesinin tahminde de Haziran'a
+// (Nisan, Mayıs'tan sonraki üçüncü aya) denk geldiğini doğrula; ay adları
+// tanındığı için fiscal_year_start_month verilmese de sonuç aynı olmalı
+func testFiscalYearStart() {
+	months := []string{"Nisan", "Mayıs", "Haziran", "Temmuz", "Ağustos", "Eylül",
+		"Ekim", "Kasım", "Aralık", "Ocak", "Şubat", "Mart"}
+
+	var history []string
+	for _, month := range months {
+		income := 100000
+		if month == "Haziran" {
+			income = 200000 // Mevsimsel zirve
+		}
+		history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 80000}`, month, income))
+	}
+
+	for _, fiscal := range []string{`, "fiscal_year_start_month": 4`, ""} {
+		body := fmt.Sprintf(`{
+			"company": {"id": "FISCAL001", "name": "Mali Yıl Testi", "sector": "Perakende"%s},
+			"historical_data": [%s]
+		}`, fiscal, strings.Join(history, ","))
+
+		result, status, err := postAnalyze(body)
+		if err != nil || status != 200 {
+			fmt.Printf("❌ İstek başarısız (status %d): %v\n", status, err)
+			return
+		}
+
+		predictions, _ := result["predictions"].([]interface{})
+		peakStep, peakIncome := -1, 0.0
+		for i, p := range predictions {
+			income, _ := p.(map[string]interface{})["income"].(float64)
+			if income > peakIncome {
+				peakStep, peakIncome = i, income
+			}
+		}
+
+		name := "Mali yıl Nisan"
+		if fiscal == "" {
+			name = "Mali yıl verilmedi"
+		}
+		// Tahmin, Mart'ta biten geçmişin ardından Nisan ile başlar
+		fmt.Printf("📊 %s: en yüksek gelir %d. tahmin ayında: %.2f\n", name, peakStep+1, peakIncome)
+		if peakStep == 2 {
+			fmt.Printf("✅ %s: mevsimsel zirve Haziran'a denk geliyor\n", name)
+		} else {
+			fmt.Printf("❌ %s: mevsimsel zirve yanlış aya kaydı\n", name)
+		}
+	}
+}
+
+// Tamamen aynı aylarda tahminin değişkenlik eksikliğiyle işaretlendiğini ve
+// güvenin yapay olarak yüksek görünmediğini doğrula
+func testIdenticalMonths() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran"}
+
+	var history []string
+	for _, month := range months {
+		history = append(history, fmt.Sprintf(`{"month": %q, "income": 100000, "expense": 80000}`, month))
+	}
+
+	body := fmt.Sprintf(`{
+		"company": {"id": "FLAT001", "name": "Sabit Veri Testi", "sector": "Hizmet"},
+		"historical_data": [%s]
+	}`, strings.Join(history, ","))
+
+	result, status, err := postAnalyze(body)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ İstek başarısız (status %d): %v\n", status, err)
+		return
+	}
+
+	flagged := false
+	warnings, _ := result["warnings"].([]interface{})
+	for _, w := range warnings {
+		if w.(map[string]interface{})["code"] == "insufficient_variation" {
+			flagged = true
+		}
+	}
+
+	predictions, _ := result["predictions"].([]interface{})
+	if len(predictions) == 0 {
+		fmt.Println("❌ Tahmin yok")
+		return
+	}
+	confidence, _ := predictions[0].(map[string]interface{})["confidence"].(float64)
+	fmt.Printf("📊 Uyarı: %v, ilk ay güveni: %.2f\n", flagged, confidence)
+
+	if flagged && confidence <= 0.5 {
+		fmt.Println("✅ Değişkenliksiz veri işaretlendi, güven düşürüldü")
+	} else {
+		fmt.Println("❌ Değişkenliksiz veri yüksek güvenle tahmin edildi")
+	}
+}
+
+// Hem "Düşüş" hem "Güçlü" sonucunu tetikleyen veride savunmacı ve büyümeci
+// önerilerin birlikte verilmediğini ve tekrar eden öneri olmadığını doğrula
+func testConflictingRecommendations() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+	expenses := []int{95000, 95000, 95000, 95000, 95000, 95000, 95000, 95000, 95000, 60000, 55000, 50000}
+
+	var history []string
+	for i, month := range months {
+		history = append(history, fmt.Sprintf(`{"month": %q, "income": 100000, "expense": %d}`, month, expenses[i]))
+	}
+
+	body := fmt.Sprintf(`{
+		"company": {"id": "CONFLICT001", "name": "Çelişki Testi", "sector": "Hizmet"},
+		"historical_data": [%s]
+	}`, strings.Join(history, ","))
+
+	result, status, err := postAnalyze(body)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ İstek başarısız (status %d): %v\n", status, err)
+		return
+	}
+
+	summary, _ := result["summary"].(map[string]interface{})
+	fmt.Printf("📊 Trend=%v, Sağlık=%v\n", summary["growth_trend"], summary["cash_flow_health"])
+
+	recommendations, _ := summary["recommendations"].([]interface{})
+	seen := map[string]bool{}
+	duplicate := false
+	for _, rec := range recommendations {
+		text := fmt.Sprint(rec)
+		duplicate = duplicate || seen[text]
+		seen[text] = true
+		fmt.Printf("  - %s\n", text)
+	}
+
+	conflict := seen["Maliyet optimizasyonu yapın"] && seen["Yatırım fırsatlarını değerlendirin"]
+	if !conflict && !duplicate {
+		fmt.Println("✅ Çelişen veya tekrar eden öneri yok")
+	} else {
+		fmt.Println("❌ Çelişen veya tekrar eden öneri bulundu")
+	}
+}
+
+// postAnalyze analiz endpoint'ine istek atıp JSON yanıtı çözer
+func postAnalyze(body string) (map[string]interface{}, int, error) {
+	resp, err := http.Post("http://localhost:8080/api/analyze", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return result, resp.StatusCode, nil
+}
+
+// Küçük harfli, büyük harfli ve Türkçe karaktersiz ay adlarının doğru aya
+// eşlendiğini ve mevsimsel hesaba katıldığını doğrula
+func testMonthNameVariants() {
+	cases := []struct {
+		name   string
+		months []string
+	}{
+		{"Küçük harf", []string{"ocak", "şubat", "mart", "nisan", "mayıs", "haziran",
+			"temmuz", "ağustos", "eylül", "ekim", "kasım", "aralık"}},
+		{"Türkçe karaktersiz", []string{"Ocak", "Subat", "Mart", "Nisan", "Mayis", "Haziran",
+			"Temmuz", "Agustos", "Eylul", "Ekim", "Kasim", "Aralik"}},
+		{"Büyük harf", []string{"OCAK", "ŞUBAT", "MART", "NİSAN", "MAYIS", "HAZİRAN",
+			"TEMMUZ", "AĞUSTOS", "EYLÜL", "EKİM", "KASIM", "ARALIK"}},
+	}
+
+	for _, c := range cases {
+		// İki yıllık veri: faktörler ancak 24 aydan itibaren hesaplanır
+		var history []string
+		for i, month := range append(c.months, c.months...) {
+			income := 100000
+			if i%12 == 1 {
+				income = 150000 // Şubat zirvesi
+			}
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 80000}`, month, income))
+		}
+
+		body := fmt.Sprintf(`{
+			"company": {"id": "MONTH001", "name": "Ay Adı Testi", "sector": "Perakende"},
+			"historical_data": [%s]
+		}`, strings.Join(history, ","))
+
+		result, status, err := postAnalyze(body)
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: istek başarısız (status %d): %v\n", c.name, status, err)
+			continue
+		}
+
+		seasonality, _ := result["seasonality"].(map[string]interface{})
+		factors, _ := seasonality["factors"].([]interface{})
+		if len(factors) != 12 {
+			fmt.Printf("❌ %s: mevsimsel faktörler yanıtta yok\n", c.name)
+			continue
+		}
+
+		february, _ := factors[1].(float64)
+		if seasonality["source"] == "computed" && february > 1.3 {
+			fmt.Printf("✅ %s: Şubat faktörü %.2f\n", c.name, february)
+		} else {
+			fmt.Printf("❌ %s: Şubat tanınmadı (faktör %.2f)\n", c.name, february)
+		}
+	}
+}
+
+// streamingReader gizlediği okuyucunun uzunluğunu saklar; istek böylece
+// Content-Length olmadan, parça parça (chunked) gönderilir
+type streamingReader struct {
+	io.Reader
+}
+
+// Varsayılan 1 MiB sınırını aşan gövdenin hem Content-Length ile
+// bildirildiğinde hem de parça parça gönderildiğinde 413 ile reddedildiğini doğrula
+func testOversizedBodies() {
+	body := `{"historical_data": [], "padding": "` + strings.Repeat("x", 2<<20) + `"}`
+	// JSON dizili toplu istek bütünüyle belleğe alındığı için max_body_bytes
+	// sınırına tabidir; yalnızca NDJSON akışı max_batch_bytes kullanır
+	batch := `{"requests": [` + body + `]}`
+
+	cases := []struct {
+		name   string
+		url    string
+		reader io.Reader
+	}{
+		{"Bildirilen Content-Length", "/api/analyze", strings.NewReader(body)},
+		{"Parça parça gönderim", "/api/analyze", streamingReader{strings.NewReader(body)}},
+		{"JSON toplu istek", "/api/batch", strings.NewReader(batch)},
+		{"Parça parça JSON toplu istek", "/api/batch", streamingReader{strings.NewReader(batch)}},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8080"+c.url, c.reader)
+		if err != nil {
+			fmt.Printf("❌ %s: istek oluşturulamadı: %v\n", c.name, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Printf("❌ %s: istek başarısız: %v\n", c.name, err)
+			continue
+		}
+
+		var apiErr map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusRequestEntityTooLarge && apiErr["error"] == "request_too_large" {
+			fmt.Printf("✅ %s: 413 request_too_large\n", c.name)
+		} else {
+			fmt.Printf("❌ %s: beklenmeyen yanıt %d %v\n", c.name, resp.StatusCode, apiErr["error"])
+		}
+	}
+
+	// Aynı toplu istek NDJSON akışıyla kabul edilmeli; yalnızca büyük öğe
+	// kendi sonucunda request_too_large almalı
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/batch", strings.NewReader(batch))
+	req.Header.Set("Accept", "application/x-ndjson")
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		fmt.Printf("❌ NDJSON toplu istek başarısız: %v\n", err)
+	} else {
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		apiErr, _ := result["error"].(map[string]interface{})
+		if resp.StatusCode != http.StatusOK || apiErr == nil || apiErr["error"] != "request_too_large" {
+			fmt.Printf("❌ NDJSON toplu istek: beklenmeyen yanıt %d %v\n", resp.StatusCode, result)
+		} else {
+			fmt.Println("✅ NDJSON toplu istek: 200, büyük öğe request_too_large")
+		}
+	}
+
+	// Reddedilen isteklerden sonra sunucu normal istekleri işlemeye devam etmeli
+	if _, status, err := postAnalyze(`{"historical_data": [{"month": "Ocak", "income": 1000, "expense": 800}]}`); err != nil || status != 200 {
+		fmt.Printf("❌ Sonraki istek başarısız (status %d): %v\n", status, err)
+	} else {
+		fmt.Println("✅ Sonraki istek sorunsuz işlendi")
+	}
+}
+
+// float64 sınırını aşan bir değerin hesaplamaya girmeden, alan ve ay adıyla
+// birlikte 422 ile reddedildiğini doğrula
+func testNonFiniteValues() {
+	result, status, err := postAnalyze(`{
+		"company": {"id": "INF001", "name": "Sonsuz Test", "sector": "Perakende"},
+		"historical_data": [
+			{"month": "Ocak", "income": 10000, "expense": 8000},
+			{"month": "Şubat", "income": 1e400, "expense": 8000},
+			{"month": "Mart", "income": 11000, "expense": 8500}
+		]
+	}`)
+	if err != nil {
+		fmt.Printf("❌ İstek başarısız: %v\n", err)
+		return
+	}
+
+	message := ""
+	if violations, _ := result["violations"].([]interface{}); len(violations) == 1 {
+		v, _ := violations[0].(map[string]interface{})
+		message, _ = v["message"].(string)
+	}
+	if status == http.StatusUnprocessableEntity && result["error"] == "non_finite_number" &&
+		result["field"] == "historical_data[1].income" && strings.Contains(message, "Şubat") {
+		fmt.Printf("✅ 1e400 reddedildi: %s\n", message)
+	} else {
+		fmt.Printf("❌ Beklenmeyen yanıt %d: %v\n", status, result)
+	}
+}
+
+// Sivri bir mevsimsel profil, seasonal_smoothing_window ile yeniden
+// çalıştırıldığında daha düzgün faktörler vermeli ve ortalaması ~1.0 kalmalı
+func testSeasonalSmoothing() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+	var history []string
+	for i := range 24 {
+		income := 10000
+		if i%2 == 1 {
+			income = 16000
+		}
+		history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 8000}`, months[i%12], income))
+	}
+	body := fmt.Sprintf(`{
+		"company": {"id": "SMOOTH001", "name": "Yumuşatma Testi", "sector": "Perakende"},
+		"historical_data": [%s]
+	}`, strings.Join(history, ","))
+
+	original, status, err := postAnalyze(body)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ Analiz başarısız (status %d): %v\n", status, err)
+		return
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://localhost:8080/api/analyses/%v/rerun", original["id"]),
+		"application/json", strings.NewReader(`{"config": {"seasonal_smoothing_window": 3}}`))
+	if err != nil {
+		fmt.Printf("❌ Yeniden çalıştırma başarısız: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	var smoothed map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&smoothed)
+
+	// swing toplam ardışık ay farkını, mean faktör ortalamasını verir
+	stats := func(result map[string]interface{}) (swing, mean float64) {
+		seasonality, _ := result["seasonality"].(map[string]interface{})
+		factors, _ := seasonality["factors"].([]interface{})
+		for i := range factors {
+			f, _ := factors[i].(float64)
+			next, _ := factors[(i+1)%len(factors)].(float64)
+			swing += math.Abs(next - f)
+			mean += f / float64(len(factors))
+		}
+		return swing, mean
+	}
+
+	// Geçersiz bir kural seti içeren geçersiz kılma, yapılandırma dosyası
+	// gibi reddedilmeli
+	badRules, err := http.Post(fmt.Sprintf("http://localhost:8080/api/analyses/%v/rerun", original["id"]),
+		"application/json", strings.NewReader(`{"config": {"recommendation_rules": [{"when": [{"metric": "yok", "op": ">", "value": 0}], "code": "X"}]}}`))
+	if err != nil {
+		fmt.Printf("❌ Geçersiz kurallı yeniden çalıştırma başarısız: %v\n", err)
+	} else {
+		badRules.Body.Close()
+		if badRules.StatusCode == http.StatusBadRequest {
+			fmt.Println("✅ Geçersiz recommendation_rules geçersiz kılması 400 ile reddedildi")
+		} else {
+			fmt.Printf("❌ Geçersiz recommendation_rules kabul edildi: %d\n", badRules.StatusCode)
+		}
+	}
+
+	// 12 aydan uzun ufuk ay adlarını tekrarlayacağından reddedilmeli
+	longHorizon, err := http.Post(fmt.Sprintf("http://localhost:8080/api/analyses/%v/rerun", original["id"]),
+		"application/json", strings.NewReader(`{"config": {"max_horizon": 13}}`))
+	if err != nil {
+		fmt.Printf("❌ max_horizon yeniden çalıştırması başarısız: %v\n", err)
+	} else {
+		longHorizon.Body.Close()
+		if longHorizon.StatusCode == http.StatusBadRequest {
+			fmt.Println("✅ 12 aydan uzun max_horizon 400 ile reddedildi")
+		} else {
+			fmt.Printf("❌ max_horizon 13 kabul edildi: %d\n", longHorizon.StatusCode)
+		}
+	}
+
+	// Reddedilen geçersiz kılma sunucunun kurallarını değiştirmemeli
+	after, err := http.Post(fmt.Sprintf("http://localhost:8080/api/analyses/%v/rerun", original["id"]),
+		"application/json", strings.NewReader(`{"config": {"seasonal_smoothing_window": 3}}`))
+	if err != nil {
+		fmt.Printf("❌ Reddin ardından yeniden çalıştırma başarısız: %v\n", err)
+	} else {
+		after.Body.Close()
+		if after.StatusCode == http.StatusOK {
+			fmt.Println("✅ Reddedilen kurallar sunucu yapılandırmasına sızmadı")
+		} else {
+			fmt.Printf("❌ Reddin ardından yeniden çalıştırma %d döndü\n", after.StatusCode)
+		}
+	}
+
+	rawSwing, rawMean := stats(original)
+	smoothSwing, smoothMean := stats(smoothed)
+	if smoothSwing < rawSwing/2 && math.Abs(smoothMean-1) < 0.01 && math.Abs(rawMean-1) < 0.01 {
+		fmt.Printf("✅ Dalgalanma %.2f → %.2f, ortalama %.3f\n", rawSwing, smoothSwing, smoothMean)
+	} else {
+		fmt.Printf("❌ Yumuşatma beklenen etkiyi vermedi: dalgalanma %.2f → %.2f, ortalama %.3f → %.3f\n",
+			rawSwing, smoothSwing, rawMean, smoothMean)
+	}
+}
+
+// Türkçe kararların yanında, etiketten bağımsız sabit kodların döndüğünü
+// doğrula: büyüyen ve küçülen iki şirket beklenen kod-etiket çiftlerini vermeli
+func testVerdictCodes() {
+	cases := []struct {
+		name    string
+		history string
+		codes   map[string]string
+		labels  map[string]string
+	}{
+		{
+			"Küçülen şirket",
+			`{"month": "Ocak", "income": 20000, "expense": 15000},
+			 {"month": "Şubat", "income": 17000, "expense": 15500},
+			 {"month": "Mart", "income": 14000, "expense": 16000},
+			 {"month": "Nisan", "income": 11000, "expense": 16500}`,
+			map[string]string{"growth_trend_code": "DOWN", "risk_level_code": "HIGH", "cash_flow_health_code": "AT_RISK"},
+			map[string]string{"growth_trend": "Düşüş", "risk_level": "Yüksek", "cash_flow_health": "Risk"},
+		},
+		{
+			"Büyüyen şirket",
+			`{"month": "Ocak", "income": 10000, "expense": 8000},
+			 {"month": "Şubat", "income": 12000, "expense": 8200},
+			 {"month": "Mart", "income": 14000, "expense": 8400},
+			 {"month": "Nisan", "income": 16000, "expense": 8600}`,
+			map[string]string{"growth_trend_code": "UP", "risk_level_code": "LOW", "cash_flow_health_code": "STRONG"},
+			map[string]string{"growth_trend": "Yükseliş", "risk_level": "Düşük", "cash_flow_health": "Güçlü"},
+		},
+	}
+
+	for _, c := range cases {
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "CODE001", "name": "Kod Testi", "sector": "Perakende"},
+			"historical_data": [%s]
+		}`, c.history))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: istek başarısız (status %d): %v\n", c.name, status, err)
+			continue
+		}
+
+		summary, _ := result["summary"].(map[string]interface{})
+		ok := true
+		for field, want := range c.codes {
+			if summary[field] != want {
+				fmt.Printf("❌ %s: %s = %v, beklenen %s\n", c.name, field, summary[field], want)
+				ok = false
+			}
+		}
+		for field, want := range c.labels {
+			if summary[field] != want {
+				fmt.Printf("❌ %s: %s = %v, beklenen %s\n", c.name, field, summary[field], want)
+				ok = false
+			}
+		}
+		if ok {
+			fmt.Printf("✅ %s: %v / %v / %v\n", c.name,
+				summary["growth_trend_code"], summary["risk_level_code"], summary["cash_flow_health_code"])
+		}
+	}
+}
+
+// Neredeyse sıfır gelirli açılış ayı büyüme oranını +%30 sınırına
+// dayandırır; skip_growth_periods: 1 ile oran gerçek ~%2 eğilime inmeli,
+// toplam gelir ise açılış ayını içermeye devam etmeli
+func testSkipGrowthPeriods() {
+	history := `[
+		{"month": "Ocak", "income": 100, "expense": 3000},
+		{"month": "Şubat", "income": 10000, "expense": 8000},
+		{"month": "Mart", "income": 10200, "expense": 8100},
+		{"month": "Nisan", "income": 10400, "expense": 8200},
+		{"month": "Mayıs", "income": 10600, "expense": 8300},
+		{"month": "Haziran", "income": 10800, "expense": 8400}
+	]`
+
+	summaries := make(map[int]map[string]interface{})
+	for _, skip := range []int{0, 1} {
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "LAUNCH001", "name": "Açılış Testi", "sector": "Hizmet"},
+			"historical_data": %s,
+			"skip_growth_periods": %d
+		}`, history, skip))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ skip_growth_periods=%d: istek başarısız (status %d): %v\n", skip, status, err)
+			return
+		}
+		summaries[skip], _ = result["summary"].(map[string]interface{})
+	}
+
+	withLaunch, _ := summaries[0]["income_growth_rate"].(float64)
+	withoutLaunch, _ := summaries[1]["income_growth_rate"].(float64)
+	if withLaunch >= 0.30 && withoutLaunch > 0.015 && withoutLaunch < 0.025 {
+		fmt.Printf("✅ Gelir büyümesi %.4f → %.4f\n", withLaunch, withoutLaunch)
+	} else {
+		fmt.Printf("❌ Beklenmeyen büyüme oranları: %.4f → %.4f\n", withLaunch, withoutLaunch)
+	}
+
+	if summaries[0]["total_historical_income"] == 52100.0 && summaries[1]["total_historical_income"] == 52100.0 {
+		fmt.Println("✅ Açılış ayı toplam gelirde kalıyor")
+	} else {
+		fmt.Printf("❌ Toplam gelir değişti: %v → %v\n",
+			summaries[0]["total_historical_income"], summaries[1]["total_historical_income"])
+	}
+}
+
+// Aynı dalgalanmayla 6, 12, 24 ve 48 aylık geçmişler gönderir; ilk tahmin
+// ayının göreli gelir aralığı geçmiş uzadıkça 1/√n ile daralmalı. Aynı
+// aylardan oluşan geçmiş ise sıfır genişlikte aralık almamalı.
+func testIntervalNarrowing() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+
+	firstInterval := func(n int, flat bool) (float64, bool) {
+		var history []string
+		for i := range n {
+			income, expense := 100000, 80000
+			if i%2 == 1 && !flat {
+				income, expense = 110000, 84000
+			}
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": %d}`, months[i%12], income, expense))
+		}
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "BAND%03d", "name": "Aralık Testi", "sector": "Hizmet"},
+			"historical_data": [%s]
+		}`, n, strings.Join(history, ",")))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %d ay: istek başarısız (status %d): %v\n", n, status, err)
+			return 0, false
+		}
+		predictions, _ := result["predictions"].([]interface{})
+		if len(predictions) == 0 {
+			fmt.Printf("❌ %d ay: tahmin yok\n", n)
+			return 0, false
+		}
+		first := predictions[0].(map[string]interface{})
+		interval, ok := first["interval"].(map[string]interface{})
+		if !ok {
+			fmt.Printf("❌ %d ay: aralık yok\n", n)
+			return 0, false
+		}
+		income, _ := first["income"].(float64)
+		return (interval["income_high"].(float64) - interval["income_low"].(float64)) / income, true
+	}
+
+	var widths []float64
+	for _, n := range []int{6, 12, 24, 48} {
+		width, ok := firstInterval(n, false)
+		if !ok {
+			return
+		}
+		fmt.Printf("📊 %d ay: göreli gelir aralığı %.4f\n", n, width)
+		widths = append(widths, width)
+	}
+	narrowing := true
+	for i := 1; i < len(widths); i++ {
+		if widths[i] >= widths[i-1] {
+			narrowing = false
+		}
+	}
+	// 48 ay 6 aya göre √8 ≈ 2.83 kat dar olmalı
+	if ratio := widths[0] / widths[3]; narrowing && ratio > 2.5 && ratio < 3.2 {
+		fmt.Printf("✅ Aralıklar geçmişle daralıyor (6/48 oranı %.2f)\n", ratio)
+	} else {
+		fmt.Printf("❌ Aralıklar beklendiği gibi daralmıyor: %v\n", widths)
+	}
+
+	if width, ok := firstInterval(6, true); ok && width > 0 {
+		fmt.Printf("✅ Aynı aylı geçmiş %.4f genişlikte aralık aldı\n", width)
+	} else if ok {
+		fmt.Println("❌ Aynı aylı geçmiş sıfır genişlikte aralık aldı")
+	}
+}
+
+// İşçi havuzunun üç katından fazla istek gönderir; her sonuç kendi
+// sırasında ve doğru şirketle dönmeli, bitince kuyruk boşalmalı
+func testBatchLargerThanPool() {
+	workers, _, err := batchMetrics()
+	if err != nil {
+		fmt.Printf("❌ Metrikler okunamadı: %v\n", err)
+		return
+	}
+
+	n := workers*3 + 1
+	requests := make([]string, n)
+	for i := range requests {
+		requests[i] = fmt.Sprintf(`{
+			"company": {"id": "POOL%03d", "name": "Havuz Testi", "sector": "Hizmet"},
+			"historical_data": [
+				{"month": "Ocak", "income": %d, "expense": 8000},
+				{"month": "Şubat", "income": %d, "expense": 8200},
+				{"month": "Mart", "income": %d, "expense": 8400}
+			]
+		}`, i, 10000+i, 10200+i, 10400+i)
+	}
+
+	resp, err := http.Post("http://localhost:8080/api/batch", "application/json",
+		bytes.NewBufferString(`{"requests": [`+strings.Join(requests, ",")+`]}`))
+	if err != nil {
+		fmt.Printf("❌ Toplu istek başarısız: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var batch struct {
+		Results []struct {
+			Index     int             `json:"index"`
+			CompanyID string          `json:"company_id"`
+			Analysis  json.RawMessage `json:"analysis"`
+			Error     json.RawMessage `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil || resp.StatusCode != 200 {
+		fmt.Printf("❌ Toplu yanıt okunamadı (status %d): %v\n", resp.StatusCode, err)
+		return
+	}
+
+	if len(batch.Results) != n {
+		fmt.Printf("❌ %d istek için %d sonuç döndü\n", n, len(batch.Results))
+		return
+	}
+	for i, r := range batch.Results {
+		if r.Index != i || r.CompanyID != fmt.Sprintf("POOL%03d", i) || r.Error != nil || len(r.Analysis) == 0 {
+			fmt.Printf("❌ %d. sonuç hatalı: index %d, şirket %s\n", i, r.Index, r.CompanyID)
+			return
+		}
+	}
+	fmt.Printf("✅ %d işçiyle %d istek sırasıyla tamamlandı\n", workers, n)
+
+	if _, depth, err := batchMetrics(); err == nil && depth == 0 {
+		fmt.Println("✅ Kuyruk derinliği sıfıra döndü")
+	} else {
+		fmt.Printf("❌ Kuyruk boşalmadı: %d (%v)\n", depth, err)
+	}
+}
+
+// batchMetrics okur: işçi havuzu boyutu ve bekleyen istek sayısı
+func batchMetrics() (workers, queueDepth int, err error) {
+	resp, err := http.Get("http://localhost:8080/api/metrics")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	var metrics struct {
+		Batch struct {
+			Workers    int `json:"workers"`
+			QueueDepth int `json:"queue_depth"`
+		} `json:"batch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return 0, 0, err
+	}
+	return metrics.Batch.Workers, metrics.Batch.QueueDepth, nil
+}
+
+// Her ay yarı yarıya düşen gelirle iki modeli dener; hiçbir tahmin ayında
+// negatif gelir veya gider çıkmamalı. Doğrusal trend sıfırın altına indiği
+// için decompose modelinde taban devreye girmeli ve aylar işaretlenmeli.
+func testZeroFloor() {
+	history := `[
+		{"month": "Ocak", "income": 64000, "expense": 40000},
+		{"month": "Şubat", "income": 32000, "expense": 35000},
+		{"month": "Mart", "income": 16000, "expense": 30000},
+		{"month": "Nisan", "income": 8000, "expense": 25000},
+		{"month": "Mayıs", "income": 4000, "expense": 20000},
+		{"month": "Haziran", "income": 2000, "expense": 15000}
+	]`
+	for _, model := range []string{"compound", "decompose"} {
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "FLOOR", "name": "Düşüş Şirketi", "sector": "Perakende"},
+			"model": %q,
+			"historical_data": %s
+		}`, model, history))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: istek başarısız (status %d): %v\n", model, status, err)
+			continue
+		}
+		predictions, _ := result["predictions"].([]interface{})
+		negative := 0
+		for _, p := range predictions {
+			month := p.(map[string]interface{})
+			if month["income"].(float64) < 0 || month["expense"].(float64) < 0 {
+				negative++
+			}
+		}
+		floored, _ := result["zero_floor_months"].([]interface{})
+		switch {
+		case len(predictions) == 0:
+			fmt.Printf("❌ %s: tahmin yok\n", model)
+		case negative > 0:
+			fmt.Printf("❌ %s: %d ayda negatif tahmin var\n", model, negative)
+		case model == "decompose" && len(floored) == 0:
+			fmt.Printf("❌ %s: taban işaretlenmedi\n", model)
+		default:
+			fmt.Printf("✅ %s: negatif tahmin yok, %d ay sıfır tabanında\n", model, len(floored))
+		}
+	}
+}
+
+// Altı aylık geçmişte iki pozitif, üç negatif ve bir başabaş ay vardır.
+// Başabaş ay hiçbir sayıma girmez ve negatif seriyi böler, bu yüzden en
+// uzun negatif seri Nisan-Mayıs'ın 2 ayıdır.
+func testNetFlowMonths() {
+	result, status, err := postAnalyze(`{
+		"company": {"id": "STREAK", "name": "Dalgalı Şirket", "sector": "Hizmet"},
+		"historical_data": [
+			{"month": "Ocak", "income": 50000, "expense": 40000},
+			{"month": "Şubat", "income": 30000, "expense": 35000},
+			{"month": "Mart", "income": 40000, "expense": 40000},
+			{"month": "Nisan", "income": 30000, "expense": 38000},
+			{"month": "Mayıs", "income": 31000, "expense": 39000},
+			{"month": "Haziran", "income": 52000, "expense": 41000}
+		]
+	}`)
+	if err != nil || status != 200 {
+		fmt.Printf("❌ İstek başarısız (status %d): %v\n", status, err)
+		return
+	}
+	summary := result["summary"].(map[string]interface{})
+	positive := summary["positive_net_flow_months"].(float64)
+	negative := summary["negative_net_flow_months"].(float64)
+	streak := summary["longest_negative_streak"].(float64)
+	if positive != 2 || negative != 3 || streak != 2 {
+		fmt.Printf("❌ Pozitif %v, negatif %v, en uzun seri %v (beklenen 2, 3, 2)\n", positive, negative, streak)
+		return
+	}
+	fmt.Printf("✅ %v pozitif, %v negatif ay, en uzun negatif seri %v ay\n", positive, negative, streak)
+}
+
+// Zarar eden bir şirkete ikinci tahmin ayında 200.000 sermaye eklenir.
+// Tahminler değişmemeli; bakiye o aydan itibaren yükselmeli, nakit ömrü
+// uzamalı ve en düşük bakiye gerilememeli.
+func testCapitalInjection() {
+	request := `{
+		"company": {"id": "FUND", "name": "Girişim", "sector": "Teknoloji"},
+		"opening_balance": 45000,
+		%s
+		"historical_data": [
+			{"month": "Ocak", "income": 20000, "expense": 30000},
+			{"month": "Şubat", "income": 21000, "expense": 31000},
+			{"month": "Mart", "income": 22000, "expense": 32000}
+		]
+	}`
+	base, status, err := postAnalyze(fmt.Sprintf(request, ""))
+	if err != nil || status != 200 {
+		fmt.Printf("❌ Temel istek başarısız (status %d): %v\n", status, err)
+		return
+	}
+	predictions := base["predictions"].([]interface{})
+	month := predictions[1].(map[string]interface{})["month"].(string)
+
+	result, status, err := postAnalyze(fmt.Sprintf(request, fmt.Sprintf(`"capital_injection": {"month": %q, "amount": 200000},`, month)))
+	if err != nil || status != 200 {
+		fmt.Printf("❌ Enjeksiyonlu istek başarısız (status %d): %v\n", status, err)
+		return
+	}
+	baseIncome := base["summary"].(map[string]interface{})["predicted_total_income"]
+	income := result["summary"].(map[string]interface{})["predicted_total_income"]
+	impact, _ := result["capital_injection"].(map[string]interface{})
+	switch {
+	case impact == nil:
+		fmt.Println("❌ capital_injection raporu yok")
+	case income != baseIncome:
+		fmt.Printf("❌ Enjeksiyon gelir sayıldı: %v yerine %v\n", baseIncome, income)
+	case impact["runway_gain"].(float64) <= 0 || impact["min_balance_change"].(float64) < 0:
+		fmt.Printf("❌ Nakit ömrü uzamadı: %v\n", impact)
+	default:
+		fmt.Printf("✅ %s ayındaki enjeksiyon nakit ömrünü %v ay uzattı\n", month, impact["runway_gain"])
+	}
+}
+
+// Sabit 10.000 gider altında net akışı hızlanarak artan, sabit hızla artan,
+// yavaşlayarak artan, yatay seyreden ve düşen şirketlerin evresini doğrula;
+// büyüme hızlanma ister, sabit hızla artış olgunluktur
+func testLifecyclePhase() {
+	cases := []struct {
+		name    string
+		incomes []int
+		want    string
+	}{
+		{"Hızlanan büyüme", []int{11000, 12000, 14000, 18000}, "GROWTH"},
+		{"Sabit hızla artış", []int{11000, 13000, 15000, 17000}, "MATURE"},
+		{"Yavaşlayan büyüme", []int{11000, 15000, 18000, 19000}, "MATURE"},
+		{"Yatay seyir", []int{15000, 15020, 14990, 15010}, "PLATEAU"},
+		{"Düşüş", []int{18000, 16000, 14000, 12000}, "DECLINE"},
+	}
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan"}
+
+	for _, c := range cases {
+		var history []string
+		for i, income := range c.incomes {
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 10000}`, months[i], income))
+		}
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "PHASE", "name": "Evre Testi", "sector": "Hizmet"},
+			"historical_data": [%s]
+		}`, strings.Join(history, ",")))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: istek başarısız (status %d): %v\n", c.name, status, err)
+			continue
+		}
+
+		summary := result["summary"].(map[string]interface{})
+		phase, _ := summary["lifecycle_phase"].(map[string]interface{})
+		if phase == nil || phase["phase_code"] != c.want {
+			fmt.Printf("❌ %s: lifecycle_phase = %v, beklenen %s\n", c.name, phase, c.want)
+			continue
+		}
+		fmt.Printf("✅ %s: %v (%v)\n", c.name, phase["phase"], phase["phase_code"])
+	}
+}
+
+// Gerçekleşen gelir tahminin %20 üzerindedir. Aynı gerçekleşmeler iki kez
+// gönderilince tek karşılaştırma sayılmalı ve düzeltme 1,2 olmalı. Düzeltilmiş
+// tahmin tam tutunca düzeltme kendini iptal etmemeli, 1,2'de kalmalı.
+func testBiasCorrection() {
+	request := fmt.Sprintf(`{
+		"company": {"id": "BIAS-%d", "name": "Sapma Şirketi", "sector": "Hizmet"},
+		"historical_data": [
+			{"month": "Ocak", "income": 50000, "expense": 30000},
+			{"month": "Şubat", "income": 51000, "expense": 30500},
+			{"month": "Mart", "income": 52000, "expense": 31000},
+			{"month": "Nisan", "income": 53000, "expense": 31500}
+		]
+	}`, time.Now().UnixNano())
+
+	postActuals := func(analysis map[string]interface{}, incomeFactor float64) (map[string]interface{}, error) {
+		var actuals []map[string]interface{}
+		for _, p := range analysis["predictions"].([]interface{})[:3] {
+			month := p.(map[string]interface{})
+			actuals = append(actuals, map[string]interface{}{
+				"month":   month["month"],
+				"income":  month["income"].(float64) * incomeFactor,
+				"expense": month["expense"],
+			})
+		}
+		body, _ := json.Marshal(map[string]interface{}{"actuals": actuals})
+		resp, err := http.Post(fmt.Sprintf("http://localhost:8080/api/analyses/%v/actuals", analysis["id"]), "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		return result, json.NewDecoder(resp.Body).Decode(&result)
+	}
+	incomeFactor := func(analysis map[string]interface{}) float64 {
+		bias, _ := analysis["bias_correction"].(map[string]interface{})
+		if bias == nil {
+			return 0
+		}
+		return bias["income_factor"].(float64)
+	}
+
+	first, _, err := postAnalyze(request)
+	if err != nil {
+		fmt.Printf("❌ İlk analiz başarısız: %v\n", err)
+		return
+	}
+	var result map[string]interface{}
+	for range 2 {
+		if result, err = postActuals(first, 1.2); err != nil {
+			fmt.Printf("❌ Gerçekleşmeler gönderilemedi: %v\n", err)
+			return
+		}
+	}
+	accuracy, _ := result["company_accuracy"].(map[string]interface{})
+	if accuracy == nil || accuracy["comparisons"] != 1.0 {
+		fmt.Printf("❌ Tekrarlanan gerçekleşmeler iki kez sayıldı: %v\n", accuracy)
+		return
+	}
+
+	second, _, _ := postAnalyze(request)
+	learned := incomeFactor(second)
+	if _, err := postActuals(second, 1); err != nil {
+		fmt.Printf("❌ İkinci gerçekleşmeler gönderilemedi: %v\n", err)
+		return
+	}
+	third, _, _ := postAnalyze(request)
+	if math.Abs(learned-1.2) > 0.01 || math.Abs(incomeFactor(third)-learned) > 0.01 {
+		fmt.Printf("❌ Düzeltme kararsız: %v sonra %v (beklenen 1,2)\n", learned, incomeFactor(third))
+		return
+	}
+	fmt.Printf("✅ Düzeltme %v, doğru çıkan düzeltilmiş tahminden sonra %v\n", learned, incomeFactor(third))
+}
+
+// Gelir ve gider birlikte ±%25 dalgalanırken net akış 20.000 civarında
+// sabit kalan gürültülü bir geçmiş gönderir. Bileşen yöntemi iki gürültülü
+// büyüme oranını birleştirip sapar; doğrudan yöntemin tahmini gerçek düzeye
+// daha yakın olmalı ve yanıt kullanılan yöntemi belirtmeli.
+func testDirectNetFlow() {
+	months := []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran",
+		"Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+	swings := []float64{0.18, -0.22, 0.05, 0.25, -0.12, -0.25, 0.2, -0.08, 0.14, -0.2, 0.24, -0.15}
+	noise := []int{600, -400, 900, -800, 300, -700, 500, -200, 800, -600, 100, -300}
+	const level = 20000.0
+
+	var history []string
+	for i, m := range months {
+		income := int(100000 * (1 + swings[i]))
+		expense := income - int(level) + noise[i]
+		history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": %d}`, m, income, expense))
+	}
+
+	meanError := func(mode string) (float64, bool) {
+		result, status, err := postAnalyze(fmt.Sprintf(`{
+			"company": {"id": "NETFLOW", "name": "Net Akış Testi", "sector": "Hizmet"},
+			"net_flow_mode": %q,
+			"historical_data": [%s]
+		}`, mode, strings.Join(history, ",")))
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: istek başarısız (status %d): %v\n", mode, status, err)
+			return 0, false
+		}
+		summary, _ := result["summary"].(map[string]interface{})
+		if summary["net_flow_mode"] != mode {
+			fmt.Printf("❌ %s: yanıttaki yöntem %v\n", mode, summary["net_flow_mode"])
+			return 0, false
+		}
+		predictions, _ := result["predictions"].([]interface{})
+		if len(predictions) == 0 {
+			fmt.Printf("❌ %s: tahmin yok\n", mode)
+			return 0, false
+		}
+		var total float64
+		for _, p := range predictions {
+			total += math.Abs(p.(map[string]interface{})["net_flow"].(float64) - level)
+		}
+		return total / float64(len(predictions)), true
+	}
+
+	components, ok := meanError("components")
+	if !ok {
+		return
+	}
+	direct, ok := meanError("direct")
+	if !ok {
+		return
+	}
+	if direct < components {
+		fmt.Printf("✅ Doğrudan tahmin daha isabetli: ortalama sapma %.0f, bileşenlerde %.0f\n", direct, components)
+	} else {
+		fmt.Printf("❌ Doğrudan tahmin daha isabetli değil: ortalama sapma %.0f, bileşenlerde %.0f\n", direct, components)
+	}
+}
+
+// Şirket adı ve sektörü 256 karakterle sınırlı: sınırdaki ad kabul edilmeli,
+// bir karakter fazlası ve megabaytlık sektör 422 string_too_long almalı.
+// Satır sonu, sekme ve ANSI kaçışı gibi kontrol karakterleri ise ayıklanmalı.
+func testCompanyStrings() {
+	analyze := func(name, sector string) (map[string]interface{}, int, error) {
+		company, _ := json.Marshal(map[string]string{"id": "TEXT", "name": name, "sector": sector})
+		return postAnalyze(fmt.Sprintf(`{
+			"company": %s,
+			"historical_data": [
+				{"month": "Ocak", "income": 100000, "expense": 80000},
+				{"month": "Şubat", "income": 105000, "expense": 82000},
+				{"month": "Mart", "income": 110000, "expense": 85000}
+			]
+		}`, company))
+	}
+
+	if _, status, err := analyze(strings.Repeat("ş", 256), "Hizmet"); err != nil || status != 200 {
+		fmt.Printf("❌ 256 karakterlik ad reddedildi (status %d): %v\n", status, err)
+	} else {
+		fmt.Println("✅ 256 karakterlik ad kabul edildi")
+	}
+
+	for _, c := range []struct{ label, name, sector, field string }{
+		{"257 karakterlik ad", strings.Repeat("ş", 257), "Hizmet", "company.name"},
+		{"1 MB sektör", "Uzun Metin", strings.Repeat("x", 1<<20-1024), "company.sector"},
+	} {
+		result, status, err := analyze(c.name, c.sector)
+		if err == nil && status == 422 && result["error"] == "string_too_long" && result["field"] == c.field {
+			fmt.Printf("✅ %s 422 string_too_long aldı\n", c.label)
+		} else {
+			fmt.Printf("❌ %s: status %d, %v (%v)\n", c.label, status, result["error"], err)
+		}
+	}
+
+	result, status, err := analyze("Sahte\n{\"level\":\"ERROR\"}\u001b[31m\tŞirket", "Hiz\rmet")
+	if err != nil || status != 200 {
+		fmt.Printf("❌ Kontrol karakterli istek başarısız (status %d): %v\n", status, err)
+		return
+	}
+	company, _ := result["company"].(map[string]interface{})
+	if company["name"] == `Sahte{"level":"ERROR"}[31mŞirket` && company["sector"] == "Hizmet" {
+		fmt.Println("✅ Kontrol karakterleri ayıklandı")
+	} else {
+		fmt.Printf("❌ Kontrol karakterleri kaldı: %q / %q\n", company["name"], company["sector"])
+	}
+}
+
+// Analizin şema ihlaliyle reddettiği bir gövde (negatif history_window ve
+// gelir), yalnızca bir bölümü döndüren uç noktalarda da aynı 400 yanıtını
+// almalı
+func testEndpointValidation() {
+	body := `{"history_window": -3, "historical_data": [
+		{"month": "Ocak", "income": -100, "expense": 80},
+		{"month": "Şubat", "income": 200, "expense": 80}
+	]}`
+
+	for _, endpoint := range []string{"/api/analyze", "/api/seasonality", "/api/trend"} {
+		resp, err := http.Post("http://localhost:8080"+endpoint, "application/json", strings.NewReader(body))
+		if err != nil {
+			fmt.Printf("❌ %s: istek başarısız: %v\n", endpoint, err)
+			continue
+		}
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusBadRequest && result["error"] == "schema_violation" {
+			fmt.Printf("✅ %s: 400 schema_violation\n", endpoint)
+		} else {
+			fmt.Printf("❌ %s: beklenmeyen yanıt %d %v\n", endpoint, resp.StatusCode, result["error"])
+		}
+	}
+
+	// trust_net_flow ile trend, gelir ve gider sabitken artan net akışı izlemeli
+	trusted := `{"trust_net_flow": true, "historical_data": [
+		{"month": "Ocak", "income": 100, "expense": 80, "net_flow": 5},
+		{"month": "Şubat", "income": 100, "expense": 80, "net_flow": 10},
+		{"month": "Mart", "income": 100, "expense": 80, "net_flow": 20}
+	]}`
+	resp, err := http.Post("http://localhost:8080/api/trend", "application/json", strings.NewReader(trusted))
+	if err != nil {
+		fmt.Printf("❌ trust_net_flow trend isteği başarısız: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	var trend map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&trend)
+	if resp.StatusCode == http.StatusOK && trend["net_flow_direction"] == "Artıyor" {
+		fmt.Println("✅ /api/trend: trust_net_flow ile verilen net akış kullanıldı")
+	} else {
+		fmt.Printf("❌ /api/trend: trust_net_flow yok sayıldı (%d, %v)\n", resp.StatusCode, trend["net_flow_direction"])
+	}
+}
+
+// Gelir tavanı ve gider sınırı tahmini değiştirdiğinde stres testinin temel
+// senaryosu analizin toplam net akışını vermeli, doğrudan net akışta da
+func testStressBaseline() {
+	for _, mode := range []string{"components", "direct"} {
+		body := fmt.Sprintf(`{
+			"company": {"id": "STRESS001", "name": "Stres Testi", "sector": "Perakende"},
+			"income_ceiling": 10000,
+			"expense_cap_ratio": 0.5,
+			"net_flow_mode": %q,
+			"historical_data": [
+				{"month": "Ocak", "income": 10000, "expense": 8000},
+				{"month": "Şubat", "income": 10100, "expense": 8000},
+				{"month": "Mart", "income": 10200, "expense": 8000},
+				{"month": "Nisan", "income": 10300, "expense": 8000},
+				{"month": "Mayıs", "income": 10400, "expense": 8000},
+				{"month": "Haziran", "income": 10500, "expense": 8000}
+			]
+		}`, mode)
+
+		analysis, status, err := postAnalyze(body)
+		if err != nil || status != 200 {
+			fmt.Printf("❌ %s: analiz başarısız (status %d): %v\n", mode, status, err)
+			continue
+		}
+		summary, _ := analysis["summary"].(map[string]interface{})
+
+		resp, err := http.Post("http://localhost:8080/api/stress", "application/json", strings.NewReader(body))
+		if err != nil {
+			fmt.Printf("❌ %s: stres isteği başarısız: %v\n", mode, err)
+			continue
+		}
+		var report map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&report)
+		resp.Body.Close()
+		baseline, _ := report["baseline"].(map[string]interface{})
+
+		if resp.StatusCode == http.StatusOK && baseline["predicted_total_net_flow"] == summary["predicted_total_net_flow"] {
+			fmt.Printf("✅ %s: temel senaryo analizle aynı (%v)\n", mode, baseline["predicted_total_net_flow"])
+		} else {
+			fmt.Printf("❌ %s: temel senaryo %v, analiz %v\n", mode, baseline["predicted_total_net_flow"], summary["predicted_total_net_flow"])
+		}
+	}
+}
+
+// Haziran'da ve Mart'ta biten iki şirketin portföy tahmini sıra numarasıyla
+// değil takvim ayıyla toplanmalı; para birimleri farklı iki şirketin
+// birleşmesi ise dönüştürülmeden toplanamayacağı için reddedilmeli
+func testPortfolioAndMerge() {
+	company := func(id, currency string, months ...string) string {
+		var history []string
+		for i, month := range months {
+			history = append(history, fmt.Sprintf(`{"month": %q, "income": %d, "expense": 80000}`, month, 100000+i*2000))
+		}
+		return fmt.Sprintf(`{"company": {"id": %q, "name": %q, "sector": "Perakende", "currency": %q}, "historical_data": [%s]}`,
+			id, id, currency, strings.Join(history, ","))
+	}
+	june := company("PORT001", "TRY", "Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran")
+	march := company("PORT002", "TRY", "Ekim", "Kasım", "Aralık", "Ocak", "Şubat", "Mart")
+
+	resp, err := http.Post("http://localhost:8080/api/portfolio", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"companies": [%s, %s], "target_currency": "TRY"}`, june, march)))
+	if err != nil {
+		fmt.Printf("❌ Portföy isteği başarısız: %v\n", err)
+		return
+	}
+	var portfolio struct {
+		Predictions []struct {
+			Period    string  `json:"period"`
+			Month     string  `json:"month"`
+			Income    float64 `json:"income"`
+			Companies int     `json:"companies"`
+		} `json:"predictions"`
+		PredictedTotalIncome float64 `json:"predicted_total_income"`
+	}
+	json.NewDecoder(resp.Body).Decode(&portfolio)
+	resp.Body.Close()
+
+	// Her şirketin altı ayı kendi takvim dönemine düşmeli: dönemler artan
+	// sırada ve tekil, aylık gelirler toplamı portföy toplamını vermeli
+	ordered := len(portfolio.Predictions) > 6
+	var companies int
+	var income float64
+	for i, p := range portfolio.Predictions {
+		if i > 0 && p.Period <= portfolio.Predictions[i-1].Period {
+			ordered = false
+		}
+		companies += p.Companies
+		income += p.Income
+	}
+	if resp.StatusCode == http.StatusOK && ordered && companies == 12 && math.Abs(income-portfolio.PredictedTotalIncome) < 1 {
+		fmt.Printf("✅ Portföy %d takvim ayına yayıldı (%s - %s)\n", len(portfolio.Predictions),
+			portfolio.Predictions[0].Period, portfolio.Predictions[len(portfolio.Predictions)-1].Period)
+	} else {
+		fmt.Printf("❌ Portföy ayları hatalı (status %d): %+v\n", resp.StatusCode, portfolio.Predictions)
+	}
+
+	usd := company("PORT003", "USD", "Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran")
+	resp, err = http.Post("http://localhost:8080/api/merge-forecast", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"first": %s, "second": %s}`, june, usd)))
+	if err != nil {
+		fmt.Printf("❌ Birleşme isteği başarısız: %v\n", err)
+		return
+	}
+	var mismatch map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&mismatch)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest && mismatch["error"] == "currency_mismatch" {
+		fmt.Println("✅ TRY ve USD şirketlerin birleşmesi currency_mismatch ile reddedildi")
+	} else {
+		fmt.Printf("❌ Farklı para birimli birleşme: %d %v\n", resp.StatusCode, mismatch["error"])
+	}
+
+	second := company("PORT004", "try", "Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran")
+	resp, err = http.Post("http://localhost:8080/api/merge-forecast", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"first": %s, "second": %s}`, june, second)))
+	if err != nil {
+		fmt.Printf("❌ Birleşme isteği başarısız: %v\n", err)
+		return
+	}
+	var merged struct {
+		Analysis struct {
+			Company struct {
+				Currency string `json:"currency"`
+			} `json:"company"`
+		} `json:"analysis"`
+	}
+	json.NewDecoder(resp.Body).Decode(&merged)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && merged.Analysis.Company.Currency == "TRY" {
+		fmt.Println("✅ Birleşen şirket TRY para birimini korudu")
+	} else {
+		fmt.Printf("❌ Birleşen şirketin para birimi: %d %q\n", resp.StatusCode, merged.Analysis.Company.Currency)
+	}
+}
+
 // Curl komutu örneği yazdır
 func printCurlExample() {
 	fmt.Println("\n📋 Manuel test için CURL komutu:")